@@ -4,8 +4,12 @@ go 1.22
 
 require (
 	github.com/bmatcuk/doublestar/v4 v4.6.1
+	github.com/dsnet/compress v0.0.1
 	github.com/kelseyhightower/envconfig v1.4.0
+	github.com/klauspost/compress v1.18.0
+	github.com/klauspost/pgzip v1.2.6
 	github.com/sirupsen/logrus v1.9.3
+	github.com/ulikunitz/xz v0.5.17
 )
 
-require golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
+require golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8
@@ -9,6 +9,9 @@ import (
 	"github.com/harness-community/drone-archive/plugin"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/sirupsen/logrus"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
@@ -30,7 +33,11 @@ func main() {
 		logrus.SetLevel(logrus.InfoLevel)
 	}
 
-	if err := args.Exec(context.Background()); err != nil {
+	// Stop, and clean up the partial target, when the pipeline is cancelled
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := args.Exec(ctx); err != nil {
 		logrus.Fatalln(err)
 	}
 }
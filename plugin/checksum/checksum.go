@@ -0,0 +1,163 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package checksum
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Supported checksum algorithms.
+const (
+	SHA256 = "sha256"
+	SHA512 = "sha512"
+)
+
+// Checksum outputs. Sidecar writes <target>.sha256 next to the target,
+// Sums adds the target to a coreutils style SHA256SUMS file in the same
+// directory.
+const (
+	Sidecar = "sidecar"
+	Sums    = "sums"
+)
+
+// New returns a hash for the named algorithm.
+func New(algorithm string) (hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case SHA256:
+		return sha256.New(), nil
+	case SHA512:
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm: %s", algorithm)
+	}
+}
+
+// Writer passes writes through to the underlying writer and hashes them
+// with every configured algorithm, so the output is checksummed in the
+// same pass that writes it.
+type Writer struct {
+	io.Writer
+	hashes map[string]hash.Hash
+}
+
+// NewWriter returns a Writer hashing with the named algorithms. Without
+// algorithms it only passes writes through.
+func NewWriter(w io.Writer, algorithms []string) (*Writer, error) {
+	hashes := map[string]hash.Hash{}
+	writers := []io.Writer{w}
+	for _, algorithm := range algorithms {
+		algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+		if algorithm == "" {
+			continue
+		}
+		if _, dup := hashes[algorithm]; dup {
+			continue
+		}
+		h, err := New(algorithm)
+		if err != nil {
+			return nil, err
+		}
+		hashes[algorithm] = h
+		writers = append(writers, h)
+	}
+	return &Writer{Writer: io.MultiWriter(writers...), hashes: hashes}, nil
+}
+
+// Sums returns the hex encoded checksum of everything written so far by
+// algorithm.
+func (w *Writer) Sums() map[string]string {
+	sums := make(map[string]string, len(w.hashes))
+	for algorithm, h := range w.hashes {
+		sums[algorithm] = hex.EncodeToString(h.Sum(nil))
+	}
+	return sums
+}
+
+// Save records the checksums of target, either as sidecar files or in
+// the combined sums file of each algorithm.
+func (w *Writer) Save(target, output string) error {
+	sums := w.Sums()
+	algorithms := make([]string, 0, len(sums))
+	for algorithm := range sums {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+
+	for _, algorithm := range algorithms {
+		var err error
+		switch output {
+		case "", Sidecar:
+			err = writeSidecar(target, algorithm, sums[algorithm])
+		case Sums:
+			err = updateSums(target, algorithm, sums[algorithm])
+		default:
+			err = fmt.Errorf("unsupported checksum output: %s", output)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeSidecar(target, algorithm, sum string) error {
+	line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(target))
+	if err := os.WriteFile(target+"."+algorithm, []byte(line), 0644); err != nil {
+		return fmt.Errorf("failed to write %s checksum: %w", algorithm, err)
+	}
+	return nil
+}
+
+// updateSums adds target to the SHA256SUMS style file next to it,
+// replacing an older line for the same file name.
+func updateSums(target, algorithm, sum string) error {
+	name := filepath.Base(target)
+	path := filepath.Join(filepath.Dir(target), strings.ToUpper(algorithm)+"SUMS")
+
+	var lines []string
+	if file, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if _, entry, ok := parseLine(scanner.Text()); ok && entry == name {
+				continue
+			}
+			lines = append(lines, scanner.Text())
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	lines = append(lines, fmt.Sprintf("%s  %s", sum, name))
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// parseLine splits a coreutils checksum line into the checksum and file
+// name. Binary mode lines mark the name with a leading asterisk.
+func parseLine(line string) (sum, name string, ok bool) {
+	sum, name, ok = strings.Cut(line, " ")
+	if !ok {
+		return "", "", false
+	}
+	name = strings.TrimPrefix(name, " ")
+	name = strings.TrimPrefix(name, "*")
+	return sum, name, true
+}
@@ -0,0 +1,80 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package checksum
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	helloSHA256 = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	helloSHA512 = "9b71d224bd62f3785d96d46ad3ea3d73319bfbc2890caadae2dff72519673ca72323c3d99ba5c11d7c7acc6e14b8c5da0c4663475c2e5c3adef46f73bcdec043"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := NewWriter(&buf, []string{"sha256", "SHA512"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	io.WriteString(writer, "hel")
+	io.WriteString(writer, "lo")
+
+	if buf.String() != "hello" {
+		t.Errorf("expected writes to pass through, got %q", buf.String())
+	}
+	sums := writer.Sums()
+	if sums[SHA256] != helloSHA256 || sums[SHA512] != helloSHA512 {
+		t.Errorf("unexpected checksums %v", sums)
+	}
+}
+
+func TestWriterUnknownAlgorithm(t *testing.T) {
+	if _, err := NewWriter(io.Discard, []string{"md4"}); err == nil {
+		t.Errorf("expected an error for an unknown algorithm")
+	}
+}
+
+func TestSaveSidecar(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "archive.zip")
+
+	writer, _ := NewWriter(io.Discard, []string{SHA256, SHA512})
+	io.WriteString(writer, "hello")
+	if err := writer.Save(target, Sidecar); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	content, _ := os.ReadFile(target + ".sha256")
+	if string(content) != helloSHA256+"  archive.zip\n" {
+		t.Errorf("unexpected sha256 sidecar %q", content)
+	}
+	content, _ = os.ReadFile(target + ".sha512")
+	if string(content) != helloSHA512+"  archive.zip\n" {
+		t.Errorf("unexpected sha512 sidecar %q", content)
+	}
+}
+
+func TestSaveSums(t *testing.T) {
+	dir := t.TempDir()
+	sumsFile := filepath.Join(dir, "SHA256SUMS")
+	os.WriteFile(sumsFile, []byte("0000  other.tar\n1111 *archive.zip\n"), 0644)
+
+	writer, _ := NewWriter(io.Discard, []string{SHA256})
+	io.WriteString(writer, "hello")
+	if err := writer.Save(filepath.Join(dir, "archive.zip"), Sums); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	content, _ := os.ReadFile(sumsFile)
+	expected := "0000  other.tar\n" + helloSHA256 + "  archive.zip\n"
+	if string(content) != expected {
+		t.Errorf("expected %q, got %q", expected, content)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package checksum
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/harness-community/drone-archive/plugin/fsutil"
+)
+
+// Expected is the checksum a file must match.
+type Expected struct {
+	Algorithm string
+	Sum       string
+}
+
+// MismatchError is returned by Verify when a file does not match its
+// expected checksum.
+type MismatchError struct {
+	Path     string
+	Expected Expected
+	Actual   string
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("%s checksum mismatch for %s: expected %s, got %s",
+		e.Expected.Algorithm, e.Path, e.Expected.Sum, e.Actual)
+}
+
+// Parse reads a checksum in the form "sha256:<hex>". Without the
+// algorithm prefix it is inferred from the length of the hex string.
+func Parse(s string) (Expected, error) {
+	algorithm, sum, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		sum, algorithm = algorithm, ""
+	}
+	return newExpected(algorithm, sum)
+}
+
+// FromFile looks up the checksum of the file called name in a coreutils
+// style checksum file, such as SHA256SUMS or a .sha256 sidecar.
+func FromFile(path, name string) (Expected, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Expected{}, fmt.Errorf("failed to open checksum file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		sum, entry, ok := parseLine(scanner.Text())
+		if !ok || filepath.Base(entry) != name {
+			continue
+		}
+		return newExpected("", sum)
+	}
+	if err := scanner.Err(); err != nil {
+		return Expected{}, fmt.Errorf("failed to read checksum file: %w", err)
+	}
+	return Expected{}, fmt.Errorf("no checksum for %s in %s", name, path)
+}
+
+// Verify hashes the file at path and returns a *MismatchError if it does
+// not match expected. Hashing stops with the error of ctx once it is done.
+func Verify(ctx context.Context, path string, expected Expected) error {
+	h, err := New(expected.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := fsutil.Copy(ctx, h, file); err != nil {
+		return fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+
+	actual := hex.EncodeToString(h.Sum(nil))
+	if actual != expected.Sum {
+		return &MismatchError{Path: path, Expected: expected, Actual: actual}
+	}
+	return nil
+}
+
+func newExpected(algorithm, sum string) (Expected, error) {
+	sum = strings.ToLower(sum)
+	if _, err := hex.DecodeString(sum); err != nil {
+		return Expected{}, fmt.Errorf("invalid checksum: %s", sum)
+	}
+
+	if algorithm == "" {
+		switch len(sum) {
+		case 64:
+			algorithm = SHA256
+		case 128:
+			algorithm = SHA512
+		default:
+			return Expected{}, fmt.Errorf("unable to infer checksum algorithm of %s", sum)
+		}
+	}
+
+	h, err := New(algorithm)
+	if err != nil {
+		return Expected{}, err
+	}
+	if len(sum) != 2*h.Size() {
+		return Expected{}, fmt.Errorf("invalid %s checksum: %s", algorithm, sum)
+	}
+	return Expected{Algorithm: strings.ToLower(algorithm), Sum: sum}, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package checksum
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		algorithm string
+		valid     bool
+	}{
+		{"sha256:" + helloSHA256, SHA256, true},
+		{"SHA256:" + strings.ToUpper(helloSHA256), SHA256, true},
+		{helloSHA256, SHA256, true},
+		{helloSHA512, SHA512, true},
+		{"sha512:" + helloSHA256, "", false},
+		{"md5:" + helloSHA256, "", false},
+		{"sha256:not-hex", "", false},
+		{"abcd", "", false},
+	}
+
+	for _, test := range tests {
+		expected, err := Parse(test.input)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("Parse(%q) expected an error", test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) error = %v", test.input, err)
+			continue
+		}
+		if expected.Algorithm != test.algorithm {
+			t.Errorf("Parse(%q) algorithm = %q, expected %q", test.input, expected.Algorithm, test.algorithm)
+		}
+	}
+}
+
+func TestFromFile(t *testing.T) {
+	sums := filepath.Join(t.TempDir(), "SHA256SUMS")
+	os.WriteFile(sums, []byte("0000000000000000000000000000000000000000000000000000000000000000  other.zip\n"+helloSHA256+" *dist/archive.zip\n"), 0644)
+
+	expected, err := FromFile(sums, "archive.zip")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if expected.Sum != helloSHA256 || expected.Algorithm != SHA256 {
+		t.Errorf("unexpected checksum %+v", expected)
+	}
+
+	if _, err := FromFile(sums, "missing.zip"); err == nil {
+		t.Errorf("expected an error for a missing entry")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.zip")
+	os.WriteFile(path, []byte("hello"), 0644)
+
+	if err := Verify(context.Background(), path, Expected{Algorithm: SHA256, Sum: helloSHA256}); err != nil {
+		t.Errorf("expected matching checksum to pass, got %v", err)
+	}
+
+	err := Verify(context.Background(), path, Expected{Algorithm: SHA512, Sum: strings.Repeat("0", 128)})
+	var mismatch *MismatchError
+	if !errors.As(err, &mismatch) || mismatch.Actual != helloSHA512 {
+		t.Errorf("expected MismatchError, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Verify(ctx, path, Expected{Algorithm: SHA256, Sum: helloSHA256}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
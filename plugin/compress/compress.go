@@ -0,0 +1,196 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package compress
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	dsnetbzip2 "github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+	"github.com/ulikunitz/xz"
+)
+
+// Supported compression algorithms.
+const (
+	Gzip  = "gzip"
+	Zstd  = "zstd"
+	Xz    = "xz"
+	Bzip2 = "bzip2"
+)
+
+// longWindowSize is the window used for zstd long distance matching,
+// the same 128 MiB window `zstd --long` uses by default.
+const longWindowSize = 1 << 27
+
+// xzDictCaps maps the xz preset levels 0-9 to the dictionary size the
+// xz utility uses for them.
+var xzDictCaps = [...]int{
+	256 << 10, 1 << 20, 2 << 20, 4 << 20, 4 << 20,
+	8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20,
+}
+
+// magics maps each algorithm to the bytes its streams start with.
+var magics = []struct {
+	name  string
+	magic []byte
+}{
+	{Gzip, []byte{0x1f, 0x8b}},
+	{Zstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{Xz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{Bzip2, []byte{'B', 'Z', 'h'}},
+}
+
+// Options tunes the compressor. The zero value selects the default
+// level of each algorithm.
+type Options struct {
+	// Level is the algorithm specific compression level, 1-22 for zstd
+	// and 1-9 for the others. Zero selects the default.
+	Level int
+
+	// Long enables long distance matching for zstd.
+	Long bool
+
+	// Workers compresses gzip streams in blocks of BlockSize bytes on
+	// that many goroutines, like pigz. The output is a standard gzip
+	// stream. Zero or one compress on a single goroutine, and zero
+	// BlockSize selects DefaultBlockSize.
+	Workers   int
+	BlockSize int
+
+	// Name and ModTime are recorded in the header of gzip streams, the
+	// original file name and modification time restored by gzip -N.
+	Name    string
+	ModTime time.Time
+}
+
+// DefaultBlockSize is the block size of parallel gzip compression.
+const DefaultBlockSize = 1 << 20
+
+// NewWriter returns a writer that compresses to w using the named
+// algorithm. Closing the writer flushes it but does not close w.
+func NewWriter(name string, w io.Writer, opts Options) (io.WriteCloser, error) {
+	switch name {
+	case Gzip:
+		level := gzip.DefaultCompression
+		if opts.Level != 0 {
+			level = opts.Level
+		}
+		if opts.Workers > 1 {
+			return newParallelGzipWriter(w, level, opts)
+		}
+		writer, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, err
+		}
+		writer.Name = opts.Name
+		writer.ModTime = opts.ModTime
+		return writer, nil
+	case Zstd:
+		zopts := []zstd.EOption{}
+		if opts.Level != 0 {
+			zopts = append(zopts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(opts.Level)))
+		}
+		if opts.Long {
+			zopts = append(zopts, zstd.WithWindowSize(longWindowSize))
+		}
+		return zstd.NewWriter(w, zopts...)
+	case Xz:
+		config := xz.WriterConfig{}
+		if opts.Level != 0 {
+			if opts.Level < 0 || opts.Level >= len(xzDictCaps) {
+				return nil, fmt.Errorf("invalid xz compression level: %d", opts.Level)
+			}
+			config.DictCap = xzDictCaps[opts.Level]
+		}
+		return config.NewWriter(w)
+	case Bzip2:
+		return dsnetbzip2.NewWriter(w, &dsnetbzip2.WriterConfig{Level: opts.Level})
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", name)
+	}
+}
+
+func newParallelGzipWriter(w io.Writer, level int, opts Options) (io.WriteCloser, error) {
+	blockSize := opts.BlockSize
+	if blockSize == 0 {
+		blockSize = DefaultBlockSize
+	}
+	if blockSize < 0 {
+		return nil, fmt.Errorf("invalid gzip block size: %d", blockSize)
+	}
+
+	writer, err := pgzip.NewWriterLevel(w, level)
+	if err != nil {
+		return nil, err
+	}
+	if err := writer.SetConcurrency(blockSize, opts.Workers); err != nil {
+		return nil, err
+	}
+	writer.Name = opts.Name
+	writer.ModTime = opts.ModTime
+	return writer, nil
+}
+
+// NewReader returns a reader that decompresses r using the named
+// algorithm. Closing the reader does not close r.
+func NewReader(name string, r io.Reader) (io.ReadCloser, error) {
+	switch name {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	case Xz:
+		reader, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(reader), nil
+	case Bzip2:
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", name)
+	}
+}
+
+// FromExtension returns the compression algorithm implied by the file
+// name, or an empty string if the name has no known compressed suffix.
+func FromExtension(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".gz"), strings.HasSuffix(name, ".tgz"):
+		return Gzip
+	case strings.HasSuffix(name, ".zst"), strings.HasSuffix(name, ".tzst"):
+		return Zstd
+	case strings.HasSuffix(name, ".xz"), strings.HasSuffix(name, ".txz"):
+		return Xz
+	case strings.HasSuffix(name, ".bz2"), strings.HasSuffix(name, ".tbz2"), strings.HasSuffix(name, ".tbz"):
+		return Bzip2
+	default:
+		return ""
+	}
+}
+
+// Detect returns the compression algorithm whose magic number header
+// starts with, or an empty string if header is not compressed with a
+// known algorithm.
+func Detect(header []byte) string {
+	for _, m := range magics {
+		if bytes.HasPrefix(header, m.magic) {
+			return m.name
+		}
+	}
+	return ""
+}
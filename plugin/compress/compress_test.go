@@ -0,0 +1,129 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	content := strings.Repeat("round trip content ", 1000)
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{Gzip, Options{}},
+		{Gzip, Options{Level: 9}},
+		{Zstd, Options{}},
+		{Zstd, Options{Level: 19}},
+		{Zstd, Options{Long: true}},
+		{Xz, Options{}},
+		{Xz, Options{Level: 9}},
+		{Bzip2, Options{}},
+		{Bzip2, Options{Level: 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, err := NewWriter(test.name, &buf, test.opts)
+			if err != nil {
+				t.Fatalf("NewWriter() error = %v", err)
+			}
+			if _, err := io.WriteString(writer, content); err != nil {
+				t.Fatalf("write error = %v", err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatalf("close error = %v", err)
+			}
+
+			if detected := Detect(buf.Bytes()); detected != test.name {
+				t.Errorf("Detect() = %q, expected %q", detected, test.name)
+			}
+
+			reader, err := NewReader(test.name, &buf)
+			if err != nil {
+				t.Fatalf("NewReader() error = %v", err)
+			}
+			defer reader.Close()
+
+			actual, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("read error = %v", err)
+			}
+			if string(actual) != content {
+				t.Errorf("round trip mismatch for %s", test.name)
+			}
+		})
+	}
+}
+
+func TestFromExtension(t *testing.T) {
+	tests := map[string]string{
+		"archive.tar.gz":  Gzip,
+		"archive.tgz":     Gzip,
+		"archive.tar.zst": Zstd,
+		"archive.TZST":    Zstd,
+		"archive.tar.xz":  Xz,
+		"archive.txz":     Xz,
+		"archive.tar.bz2": Bzip2,
+		"archive.tbz2":    Bzip2,
+		"archive.tar":     "",
+		"archive.zip":     "",
+	}
+
+	for name, expected := range tests {
+		if actual := FromExtension(name); actual != expected {
+			t.Errorf("FromExtension(%q) = %q, expected %q", name, actual, expected)
+		}
+	}
+}
+
+func TestDetectUncompressed(t *testing.T) {
+	for _, header := range []string{"", "PK\x03\x04", "plain text"} {
+		if actual := Detect([]byte(header)); actual != "" {
+			t.Errorf("Detect(%q) = %q, expected no compression", header, actual)
+		}
+	}
+}
+
+func TestParallelGzip(t *testing.T) {
+	// Several blocks, each compressed on its own goroutine
+	content := strings.Repeat("parallel gzip content ", 20000)
+
+	var buf bytes.Buffer
+	writer, err := NewWriter(Gzip, &buf, Options{Workers: 4, BlockSize: 64 << 10})
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	if _, err := io.WriteString(writer, content); err != nil {
+		t.Fatalf("write error = %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close error = %v", err)
+	}
+
+	// The output must be a standard gzip stream
+	reader, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	actual, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("read error = %v", err)
+	}
+	if string(actual) != content {
+		t.Errorf("expected %d bytes of content, got %d", len(content), len(actual))
+	}
+
+	if _, err := NewWriter(Gzip, &buf, Options{Workers: 4, BlockSize: -1}); err == nil {
+		t.Errorf("expected an error for a negative block size")
+	}
+}
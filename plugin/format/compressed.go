@@ -0,0 +1,257 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package format
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/harness-community/drone-archive/plugin/checksum"
+	"github.com/harness-community/drone-archive/plugin/compress"
+	"github.com/harness-community/drone-archive/plugin/fsutil"
+	"github.com/harness-community/drone-archive/plugin/match"
+)
+
+// CompressedFormat is the Format of a single file compressed with the
+// algorithm named by Compression, such as zstd, xz or bzip2. Register it
+// under the name of the algorithm.
+type CompressedFormat struct {
+	Compression string
+}
+
+func (f CompressedFormat) Archive(ctx context.Context, sources []Source, target string, opts Options) error {
+	source, err := SingleSource(sources)
+	if err != nil {
+		return err
+	}
+	return CompressFile(ctx, source, target, f.Compression, opts)
+}
+
+func (f CompressedFormat) Extract(ctx context.Context, source, target string, opts Options) error {
+	return DecompressFile(ctx, source, target, f.Compression, opts)
+}
+
+func (f CompressedFormat) List(ctx context.Context, source string, opts Options) ([]Entry, error) {
+	return ListCompressed(ctx, source, f.Compression, opts)
+}
+
+func (f CompressedFormat) Test(ctx context.Context, source string, opts Options) error {
+	return TestCompressed(ctx, source, f.Compression)
+}
+
+// CompressFile compresses the file at source to target with the named
+// algorithm. Formats with a header, like gzip, record the original name
+// and modification time of the file in it.
+func CompressFile(ctx context.Context, source, target, compression string, opts Options) error {
+	// Ensure the target directory exists
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create target directory: %w", err)
+	}
+
+	in, err := os.Open(source)
+	if err != nil {
+		return fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	modTime := info.ModTime()
+	if opts.Reproducible {
+		modTime = fsutil.ClampTime(modTime, opts.Epoch)
+	}
+
+	// Write to a temporary file that replaces the target once complete
+	out, err := fsutil.CreateAtomic(target, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create target file: %w", err)
+	}
+	defer out.Cleanup()
+
+	// Checksum the compressed file while it is written
+	hashed, err := checksum.NewWriter(out, opts.Checksums)
+	if err != nil {
+		return err
+	}
+
+	writer, err := compress.NewWriter(compression, hashed, compress.Options{
+		Level:     opts.Level,
+		Long:      opts.Long,
+		Workers:   opts.Workers,
+		BlockSize: opts.BlockSize,
+		Name:      filepath.Base(source),
+		ModTime:   modTime,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create %s writer: %w", compression, err)
+	}
+	defer writer.Close()
+
+	if _, err := fsutil.Copy(ctx, writer, in); err != nil {
+		return fmt.Errorf("failed to compress file: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to compress file: %w", err)
+	}
+	if err := out.Commit(); err != nil {
+		return fmt.Errorf("failed to write target file: %w", err)
+	}
+	return hashed.Save(target, opts.ChecksumOutput)
+}
+
+// DecompressFile decompresses the file at source, compressed with the
+// named algorithm, to target. An existing target is handled according to
+// opts.Conflict.
+func DecompressFile(ctx context.Context, source, target, compression string, opts Options) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	reader, err := compress.NewReader(compression, in)
+	if err != nil {
+		return fmt.Errorf("failed to create %s reader: %w", compression, err)
+	}
+	defer reader.Close()
+
+	_, err = WriteDecompressed(ctx, reader, target, info.ModTime(), opts, NewLimiter(opts.Limits, info.Size()))
+	return err
+}
+
+// WriteDecompressed writes the decompressed stream r to target, counting
+// it against limiter. An existing target is handled according to
+// opts.Conflict, comparing it against modTime for newer. It returns the
+// path written, which differs from target when renamed, or an empty
+// string if the target was skipped.
+func WriteDecompressed(ctx context.Context, r io.Reader, target string, modTime time.Time, opts Options, limiter *Limiter) (string, error) {
+	// Ensure the target directory exists
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", fmt.Errorf("failed to create target directory: %w", err)
+	}
+
+	resolved, err := opts.ResolveConflict(target, modTime)
+	if err != nil {
+		return "", err
+	}
+	if resolved == "" {
+		fmt.Printf("Skipping existing file: %s\n", target)
+		return "", nil
+	}
+	target = resolved
+
+	// Write to a temporary file that replaces the target once complete
+	out, err := fsutil.CreateAtomic(target, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to create target file: %w", err)
+	}
+	defer out.Cleanup()
+
+	if _, err := fsutil.Copy(ctx, out, limiter.Reader(filepath.Base(target), r)); err != nil {
+		return "", fmt.Errorf("failed to decompress file: %w", err)
+	}
+
+	if err := out.Commit(); err != nil {
+		return "", fmt.Errorf("failed to write target file: %w", err)
+	}
+	return target, nil
+}
+
+// ListCompressed lists a file compressed with the named algorithm as a
+// single entry, named after the source without its compression suffix.
+// The uncompressed size is found by decompressing the whole stream.
+func ListCompressed(ctx context.Context, source, compression string, opts Options) ([]Entry, error) {
+	name := CompressedName(source, compression)
+
+	if !match.Selected(name, opts.Globs, nil) {
+		return nil, nil
+	}
+
+	in, err := os.Open(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := compress.NewReader(compression, in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s reader: %w", compression, err)
+	}
+	defer reader.Close()
+
+	size, err := fsutil.Copy(ctx, io.Discard, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress file: %w", err)
+	}
+
+	return []Entry{{
+		Name:           name,
+		Type:           TypeFile,
+		Size:           size,
+		CompressedSize: info.Size(),
+		Mode:           info.Mode(),
+		ModTime:        info.ModTime(),
+	}}, nil
+}
+
+// TestCompressed decompresses the file at source with the named algorithm
+// and discards the output, which verifies the checksums in the stream.
+func TestCompressed(ctx context.Context, source, compression string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer in.Close()
+
+	reader, err := compress.NewReader(compression, in)
+	if err == nil {
+		defer reader.Close()
+		_, err = fsutil.Copy(ctx, io.Discard, reader)
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if err != nil {
+		return &CorruptError{
+			Source:  source,
+			Entries: []CorruptEntry{{Name: CompressedName(source, compression), Err: err}},
+		}
+	}
+	return nil
+}
+
+// CompressedName returns the name of the file compressed at source with
+// the named algorithm, its base name without the compression extension.
+// The short forms of compressed tarballs, like .tgz, become .tar.
+func CompressedName(source, compression string) string {
+	name := filepath.Base(source)
+	if compress.FromExtension(name) != compression {
+		return name
+	}
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	if strings.HasPrefix(strings.ToLower(ext), ".t") {
+		return stem + ".tar"
+	}
+	return stem
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package format
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/harness-community/drone-archive/plugin/compress"
+)
+
+func TestCompressedFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		ext  string
+		opts Options
+	}{
+		{compress.Zstd, ".zst", Options{}},
+		{compress.Zstd, ".zst", Options{Level: 19}},
+		{compress.Zstd, ".zst", Options{Long: true}},
+		{compress.Xz, ".xz", Options{}},
+		{compress.Xz, ".xz", Options{Level: 9}},
+		{compress.Bzip2, ".bz2", Options{}},
+		{compress.Bzip2, ".bz2", Options{Level: 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := CompressedFormat{Compression: test.name}
+
+			dir := t.TempDir()
+			source := filepath.Join(dir, "testfile.txt")
+			os.WriteFile(source, []byte("This is a test file content"), 0644)
+
+			compressed := filepath.Join(dir, "testfile.txt"+test.ext)
+			if err := f.Archive(context.Background(), Sources(source), compressed, test.opts); err != nil {
+				t.Fatalf("Archive() error = %v", err)
+			}
+			if err := f.Test(context.Background(), compressed, Options{}); err != nil {
+				t.Fatalf("Test() error = %v", err)
+			}
+
+			entries, err := f.List(context.Background(), compressed, Options{})
+			if err != nil || len(entries) != 1 || entries[0].Name != "testfile.txt" {
+				t.Fatalf("expected a single testfile.txt entry, got %+v, %v", entries, err)
+			}
+
+			target := filepath.Join(dir, "out.txt")
+			if err := f.Extract(context.Background(), compressed, target, Options{}); err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			content, err := os.ReadFile(target)
+			if err != nil || string(content) != "This is a test file content" {
+				t.Errorf("expected the original content, got %q, %v", content, err)
+			}
+
+			// An existing target fails by default
+			var conflict *ConflictError
+			if err := f.Extract(context.Background(), compressed, target, Options{}); !errors.As(err, &conflict) {
+				t.Errorf("expected ConflictError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDecompressFileLimits(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "zeros")
+	os.WriteFile(source, make([]byte, 1<<20), 0644)
+	compressed := filepath.Join(dir, "zeros.zst")
+	if err := CompressFile(context.Background(), source, compressed, compress.Zstd, Options{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	target := filepath.Join(dir, "out")
+	opts := Options{Limits: Limits{MaxFileSize: 1 << 10}}
+	var limited *LimitError
+	if err := DecompressFile(context.Background(), compressed, target, compress.Zstd, opts); !errors.As(err, &limited) {
+		t.Fatalf("expected LimitError, got %v", err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("expected no target after an aborted extraction, got %v", err)
+	}
+}
+
+func TestCompressedName(t *testing.T) {
+	tests := []struct {
+		source      string
+		compression string
+		expected    string
+	}{
+		{"dist/app.zst", compress.Zstd, "app"},
+		{"app.tar.xz", compress.Xz, "app.tar"},
+		{"app.tgz", compress.Gzip, "app.tar"},
+		{"app.tbz2", compress.Bzip2, "app.tar"},
+		{"app.bin", compress.Zstd, "app.bin"},
+	}
+
+	for _, test := range tests {
+		if actual := CompressedName(test.source, test.compression); actual != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.source, test.expected, actual)
+		}
+	}
+}
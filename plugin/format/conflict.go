@@ -0,0 +1,135 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package format
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Policies for a file that is about to be written but already exists.
+const (
+	ConflictFail      = "fail"
+	ConflictOverwrite = "overwrite"
+	ConflictSkip      = "skip"
+	ConflictNewer     = "newer"
+	ConflictRename    = "rename"
+)
+
+// ConflictError reports a file that already exists under ConflictFail.
+type ConflictError struct {
+	Path string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("target file already exists: %s", e.Path)
+}
+
+// ResolveConflict applies opts.Conflict to path, a file about to be
+// written with the given modification time. It returns the path to write
+// to, which differs under ConflictRename, or an empty path if the file is
+// to be skipped. An existing file that is to be replaced is not removed.
+func (opts Options) ResolveConflict(path string, modTime time.Time) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("no target given")
+	}
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return path, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	switch opts.Conflict {
+	case ConflictOverwrite:
+		return path, nil
+	case ConflictSkip:
+		return "", nil
+	case ConflictNewer:
+		if modTime.After(info.ModTime()) {
+			return path, nil
+		}
+		return "", nil
+	case ConflictRename:
+		return uniquePath(path), nil
+	case ConflictFail, "":
+		return "", &ConflictError{Path: path}
+	default:
+		return "", fmt.Errorf("unsupported conflict policy: %s", opts.Conflict)
+	}
+}
+
+// Conflicts applies the conflict policy to the files of one extraction.
+// Files the extraction wrote itself, like duplicate entries, are replaced
+// without applying the policy.
+type Conflicts struct {
+	opts    Options
+	written map[string]bool
+	renamed map[string]string
+}
+
+// NewConflicts returns Conflicts for an extraction with opts.
+func NewConflicts(opts Options) *Conflicts {
+	return &Conflicts{
+		opts:    opts,
+		written: map[string]bool{},
+		renamed: map[string]string{},
+	}
+}
+
+// Resolve returns the path to extract the file meant for path to, or an
+// empty path to skip it, see Options.ResolveConflict.
+func (c *Conflicts) Resolve(path string, modTime time.Time) (string, error) {
+	if c.written[path] {
+		return path, nil
+	}
+	resolved, err := c.opts.ResolveConflict(path, modTime)
+	if err != nil || resolved == "" {
+		return resolved, err
+	}
+	c.written[resolved] = true
+	if resolved != path {
+		c.renamed[path] = resolved
+	}
+	return resolved, nil
+}
+
+// Path returns the path the file meant for path was extracted to, which
+// differs if it was renamed.
+func (c *Conflicts) Path(path string) string {
+	if renamed, ok := c.renamed[path]; ok {
+		return renamed
+	}
+	return path
+}
+
+// uniquePath numbers the file name of p, as in app-1.tar.gz, until
+// nothing exists at it.
+func uniquePath(p string) string {
+	dir, base := filepath.Split(p)
+	stem, ext := splitExt(base)
+	for i := 1; ; i++ {
+		candidate := filepath.Join(dir, fmt.Sprintf("%s-%d%s", stem, i, ext))
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+// splitExt splits name before its extension, keeping compressed tar
+// extensions like .tar.gz whole.
+func splitExt(name string) (string, string) {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	if filepath.Ext(stem) == ".tar" {
+		ext = ".tar" + ext
+		stem = strings.TrimSuffix(stem, ".tar")
+	}
+	return stem, ext
+}
@@ -0,0 +1,55 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package format
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResolveConflict(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "app.tar.gz")
+	os.WriteFile(existing, []byte("existing"), 0644)
+	os.WriteFile(filepath.Join(dir, "app-1.tar.gz"), []byte("existing"), 0644)
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	os.Chtimes(existing, modTime, modTime)
+
+	tests := []struct {
+		conflict string
+		modTime  time.Time
+		expected string
+	}{
+		{ConflictOverwrite, modTime, existing},
+		{ConflictSkip, modTime, ""},
+		{ConflictNewer, modTime, ""},
+		{ConflictNewer, modTime.Add(time.Second), existing},
+		{ConflictRename, modTime, filepath.Join(dir, "app-2.tar.gz")},
+	}
+
+	for _, test := range tests {
+		actual, err := Options{Conflict: test.conflict}.ResolveConflict(existing, test.modTime)
+		if err != nil || actual != test.expected {
+			t.Errorf("%s: expected %q, got %q, %v", test.conflict, test.expected, actual, err)
+		}
+	}
+
+	var conflict *ConflictError
+	if _, err := (Options{}).ResolveConflict(existing, modTime); !errors.As(err, &conflict) {
+		t.Errorf("expected ConflictError by default, got %v", err)
+	}
+
+	missing := filepath.Join(dir, "missing.zip")
+	if actual, err := (Options{}).ResolveConflict(missing, modTime); err != nil || actual != missing {
+		t.Errorf("expected %q for a missing file, got %q, %v", missing, actual, err)
+	}
+
+	if _, err := (Options{Conflict: ConflictSkip}).ResolveConflict("", modTime); err == nil {
+		t.Errorf("expected an error for an empty path")
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package format
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CorruptEntry names an archive entry that failed verification.
+type CorruptEntry struct {
+	Name string
+	Err  error
+}
+
+// CorruptError is returned by Format.Test when one or more entries of an
+// archive fail verification.
+type CorruptError struct {
+	Source  string
+	Entries []CorruptEntry
+}
+
+func (e *CorruptError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s is corrupted, %d entries failed verification:", e.Source, len(e.Entries))
+	for _, entry := range e.Entries {
+		fmt.Fprintf(&b, "\n  %s: %v", entry.Name, entry.Err)
+	}
+	return b.String()
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/harness-community/drone-archive/plugin/compress"
+)
+
+// Auto is the format name that asks for the format to be detected from
+// the content of the source.
+const Auto = "auto"
+
+// sniffLen is enough to cover the ustar magic at offset 257.
+const sniffLen = 512
+
+var (
+	zipMagic      = []byte("PK\x03\x04")
+	zipEmptyMagic = []byte("PK\x05\x06")
+	tarMagic      = []byte("ustar")
+	tarMagicAt    = 257
+)
+
+// Detect sniffs the magic bytes of the file at path and returns the name
+// of the format that extracts it. A tar archive wrapped in a compression
+// stream is reported as "tar", any other compressed file by the name of
+// its compression algorithm.
+func Detect(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, sniffLen)
+	header, err := reader.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read source file: %w", err)
+	}
+
+	if bytes.HasPrefix(header, zipMagic) || bytes.HasPrefix(header, zipEmptyMagic) {
+		return "zip", nil
+	}
+	if isTar(header) {
+		return "tar", nil
+	}
+
+	compression := compress.Detect(header)
+	if compression == "" {
+		return "", fmt.Errorf("unable to detect format of %s", path)
+	}
+
+	decompressor, err := compress.NewReader(compression, reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s reader: %w", compression, err)
+	}
+	defer decompressor.Close()
+
+	inner := make([]byte, sniffLen)
+	n, err := io.ReadFull(decompressor, inner)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("failed to decompress %s: %w", path, err)
+	}
+	if isTar(inner[:n]) {
+		return "tar", nil
+	}
+	return compression, nil
+}
+
+func isTar(header []byte) bool {
+	if len(header) < tarMagicAt+len(tarMagic) {
+		return false
+	}
+	return bytes.Equal(header[tarMagicAt:tarMagicAt+len(tarMagic)], tarMagic)
+}
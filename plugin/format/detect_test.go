@@ -0,0 +1,99 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package format
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/harness-community/drone-archive/plugin/compress"
+)
+
+func TestDetect(t *testing.T) {
+	tarball := tarBytes(t)
+
+	tests := []struct {
+		name     string
+		content  []byte
+		expected string
+	}{
+		{"zip", zipBytes(t), "zip"},
+		{"tar", tarball, "tar"},
+		{"tar in gzip", compressBytes(t, compress.Gzip, tarball), "tar"},
+		{"tar in zstd", compressBytes(t, compress.Zstd, tarball), "tar"},
+		{"tar in xz", compressBytes(t, compress.Xz, tarball), "tar"},
+		{"tar in bzip2", compressBytes(t, compress.Bzip2, tarball), "tar"},
+		{"plain gzip", compressBytes(t, compress.Gzip, []byte("hello")), "gzip"},
+		{"plain zstd", compressBytes(t, compress.Zstd, []byte("hello")), "zstd"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// A misleading extension must not affect detection.
+			path := filepath.Join(t.TempDir(), "artifact.bin")
+			if err := os.WriteFile(path, test.content, 0644); err != nil {
+				t.Fatalf("unable to write test file: %v", err)
+			}
+
+			actual, err := Detect(path)
+			if err != nil {
+				t.Fatalf("Detect() error = %v", err)
+			}
+			if actual != test.expected {
+				t.Errorf("Detect() = %q, expected %q", actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestDetectUnknown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "artifact.txt")
+	if err := os.WriteFile(path, []byte("plain text"), 0644); err != nil {
+		t.Fatalf("unable to write test file: %v", err)
+	}
+
+	if _, err := Detect(path); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
+
+func zipBytes(t *testing.T) []byte {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	f, err := writer.Create("file.txt")
+	if err != nil {
+		t.Fatalf("unable to create zip entry: %v", err)
+	}
+	f.Write([]byte("hello"))
+	writer.Close()
+	return buf.Bytes()
+}
+
+func tarBytes(t *testing.T) []byte {
+	var buf bytes.Buffer
+	writer := tar.NewWriter(&buf)
+	header := &tar.Header{Name: "file.txt", Mode: 0644, Size: 5}
+	if err := writer.WriteHeader(header); err != nil {
+		t.Fatalf("unable to write tar header: %v", err)
+	}
+	writer.Write([]byte("hello"))
+	writer.Close()
+	return buf.Bytes()
+}
+
+func compressBytes(t *testing.T, name string, content []byte) []byte {
+	var buf bytes.Buffer
+	writer, err := compress.NewWriter(name, &buf, compress.Options{})
+	if err != nil {
+		t.Fatalf("unable to create %s writer: %v", name, err)
+	}
+	writer.Write(content)
+	writer.Close()
+	return buf.Bytes()
+}
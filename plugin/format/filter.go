@@ -0,0 +1,61 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package format
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/harness-community/drone-archive/plugin/match"
+)
+
+// Filter selects the files of a source to archive, applying the glob,
+// exclude and ignore file settings of the options. Use a new Filter for
+// every source.
+type Filter struct {
+	opts   Options
+	ignore match.Ignore
+}
+
+// NewFilter returns a Filter for opts, reading the rules of
+// opts.IgnoreFile.
+func NewFilter(opts Options) (*Filter, error) {
+	f := &Filter{opts: opts}
+	if opts.IgnoreFile != "" {
+		if err := f.ignore.AddFile("", opts.IgnoreFile); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Visit reports whether the file at path, found while walking the source
+// and named name relative to it, is archived. It returns filepath.SkipDir
+// for a directory left out with everything below it. The root of the
+// source, with an empty name, is always archived.
+func (f *Filter) Visit(name, path string, info os.FileInfo) (bool, error) {
+	if name != "" {
+		if match.Any(f.opts.Excludes, name) || f.ignore.Ignored(name, info.IsDir()) {
+			if info.IsDir() {
+				return false, filepath.SkipDir
+			}
+			return false, nil
+		}
+	}
+
+	// The rules of ignore files apply to the contents of their directory
+	if info.IsDir() {
+		for _, ignoreName := range f.opts.IgnoreNames {
+			err := f.ignore.AddFile(name, filepath.Join(path, ignoreName))
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return false, err
+			}
+		}
+	}
+
+	return name == "" || match.Selected(name, f.opts.Globs, nil), nil
+}
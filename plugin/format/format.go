@@ -0,0 +1,189 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package format
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/harness-community/drone-archive/plugin/fsutil"
+)
+
+// Options holds the settings shared by every format. Formats ignore
+// the fields that do not apply to them.
+type Options struct {
+	// Globs selects the files to archive or extract, Excludes the files
+	// to leave out. A file is selected if it matches any of the globs,
+	// or there are none, and none of the excludes.
+	Globs    []string
+	Excludes []string
+
+	// IgnoreFile is a gitignore style file whose rules apply to every
+	// source. IgnoreNames lists the names of ignore files, like
+	// .gitignore, honored in every directory of a source.
+	IgnoreFile  string
+	IgnoreNames []string
+
+	// StripComponents removes that many leading directories from entry
+	// names and Prefix is then prepended to them, see Rename.
+	StripComponents int
+	Prefix          string
+
+	// Conflict is the policy for files that already exist, one of
+	// ConflictFail, the default, ConflictOverwrite, ConflictSkip,
+	// ConflictNewer or ConflictRename. It applies to every extracted file
+	// and to the target of single file formats, see ResolveConflict.
+	Conflict string
+
+	// Limits bounds what extraction may write.
+	Limits Limits
+
+	// Flatten drops the directory structure, storing or extracting files
+	// under their base name only. FlattenCollision is CollisionFail,
+	// the default, CollisionRename or CollisionOverwrite, and selects how
+	// files with the same base name are handled.
+	Flatten          bool
+	FlattenCollision string
+
+	// Compression names the algorithm used to compress archives that
+	// support it, such as tar. Empty means uncompressed.
+	Compression string
+
+	// Level, Long, Workers and BlockSize tune the compressor, see
+	// compress.Options.
+	Level     int
+	Long      bool
+	Workers   int
+	BlockSize int
+
+	// FollowSymlinks archives the files symlinks point to instead of
+	// the links themselves.
+	FollowSymlinks bool
+
+	// Preserve selects the file attributes restored on extraction.
+	Preserve fsutil.Preserve
+
+	// Reproducible makes archiving the same tree twice produce identical
+	// bytes. Modification times are clamped to Epoch, ownership is
+	// dropped and permissions are normalized.
+	Reproducible bool
+	Epoch        time.Time
+
+	// Checksums lists the algorithms, such as sha256, used to checksum
+	// created archives. ChecksumOutput selects how the checksums are
+	// saved, see checksum.Writer.Save.
+	Checksums      []string
+	ChecksumOutput string
+}
+
+// Entry types reported by List.
+const (
+	TypeFile     = "file"
+	TypeDir      = "dir"
+	TypeSymlink  = "symlink"
+	TypeHardlink = "hardlink"
+	TypeOther    = "other"
+)
+
+// Entry describes a single member of an archive.
+type Entry struct {
+	Name     string
+	Type     string
+	Linkname string
+	Size     int64
+
+	// CompressedSize is the stored size of the entry, or -1 if the
+	// archive does not compress entries individually, like tar.
+	CompressedSize int64
+
+	Mode    os.FileMode
+	ModTime time.Time
+}
+
+// Ratio returns the space saved by compressing the entry as a fraction of
+// its size. It reports false if the entry is empty or its compressed
+// size is unknown.
+func (e Entry) Ratio() (float64, bool) {
+	if e.Size <= 0 || e.CompressedSize < 0 {
+		return 0, false
+	}
+	return 1 - float64(e.CompressedSize)/float64(e.Size), true
+}
+
+// Format is implemented by every archive or compression format the
+// plugin can handle. Implementations register themselves with Register,
+// usually from an init function.
+type Format interface {
+	// Archive creates target from the files and directories of the
+	// sources. Formats that compress a single file reject more than one.
+	Archive(ctx context.Context, sources []Source, target string, opts Options) error
+
+	// Extract unpacks the archive at source into target.
+	Extract(ctx context.Context, source, target string, opts Options) error
+
+	// List returns the entries of the archive at source.
+	List(ctx context.Context, source string, opts Options) ([]Entry, error)
+
+	// Test reads the archive at source and reports any corruption
+	// without writing to disk.
+	Test(ctx context.Context, source string, opts Options) error
+}
+
+// BatchFormat is implemented by single file formats that can also
+// compress every file of a directory or glob, each to its own target,
+// like gzip -r.
+type BatchFormat interface {
+	// Batch reports whether the sources select more than a single file.
+	// Archive then writes into the target directory, or next to every
+	// file if the target is empty, and applies the conflict policy to
+	// every file it writes.
+	Batch(sources []Source) bool
+}
+
+var (
+	mu      sync.RWMutex
+	formats = map[string]Format{}
+)
+
+// Register makes a format available under the given name. It panics if
+// the name is registered twice or if f is nil.
+func Register(name string, f Format) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if f == nil {
+		panic("format: Register format is nil")
+	}
+	if _, dup := formats[name]; dup {
+		panic(fmt.Sprintf("format: Register called twice for format %s", name))
+	}
+	formats[name] = f
+}
+
+// Lookup returns the format registered under name.
+func Lookup(name string) (Format, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	f, ok := formats[name]
+	return f, ok
+}
+
+// Names returns the sorted names of all registered formats.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
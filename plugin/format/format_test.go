@@ -0,0 +1,146 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package format
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type fakeFormat struct{}
+
+func (fakeFormat) Archive(context.Context, []Source, string, Options) error { return nil }
+func (fakeFormat) Extract(context.Context, string, string, Options) error   { return nil }
+func (fakeFormat) List(context.Context, string, Options) ([]Entry, error)   { return nil, nil }
+func (fakeFormat) Test(context.Context, string, Options) error              { return nil }
+
+func TestRegisterLookup(t *testing.T) {
+	Register("fake-b", fakeFormat{})
+	Register("fake-a", fakeFormat{})
+
+	if _, ok := Lookup("fake-a"); !ok {
+		t.Fatalf("expected fake-a to be registered")
+	}
+	if _, ok := Lookup("missing"); ok {
+		t.Fatalf("expected missing format to be absent")
+	}
+
+	names := Names()
+	if !reflect.DeepEqual(names, []string{"fake-a", "fake-b"}) {
+		t.Errorf("expected sorted names, got %v", names)
+	}
+}
+
+func TestRegisterDuplicatePanics(t *testing.T) {
+	Register("fake-dup", fakeFormat{})
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected duplicate registration to panic")
+		}
+	}()
+	Register("fake-dup", fakeFormat{})
+}
+
+func TestEntryRatio(t *testing.T) {
+	if ratio, ok := (Entry{Size: 100, CompressedSize: 25}).Ratio(); !ok || ratio != 0.75 {
+		t.Errorf("expected ratio 0.75, got %v, %v", ratio, ok)
+	}
+	if _, ok := (Entry{Size: 100, CompressedSize: -1}).Ratio(); ok {
+		t.Errorf("expected no ratio for unknown compressed size")
+	}
+	if _, ok := (Entry{}).Ratio(); ok {
+		t.Errorf("expected no ratio for empty entry")
+	}
+}
+
+func TestParseSource(t *testing.T) {
+	tests := map[string]Source{
+		"dist":                  {Path: "dist"},
+		"dist=bundle/dist":      {Path: "dist", Prefix: "bundle/dist"},
+		" docs = /bundle/doc/ ": {Path: "docs", Prefix: "bundle/doc"},
+	}
+
+	for input, expected := range tests {
+		if actual := ParseSource(input); actual != expected {
+			t.Errorf("ParseSource(%q) = %+v, expected %+v", input, actual, expected)
+		}
+	}
+}
+
+func TestRename(t *testing.T) {
+	tests := []struct {
+		name     string
+		strip    int
+		prefix   string
+		expected string
+		ok       bool
+	}{
+		{"project-1.2.3/src/main.go", 0, "", "project-1.2.3/src/main.go", true},
+		{"project-1.2.3/src/main.go", 1, "", "src/main.go", true},
+		{"project-1.2.3/src/", 1, "", "src/", true},
+		{"project-1.2.3/", 1, "", "", false},
+		{"project-1.2.3/README", 2, "", "", false},
+		{"./project-1.2.3/README", 1, "", "README", true},
+		{"project-1.2.3/README", 1, "project", "project/README", true},
+		{"dist/app", 0, "/release/", "release/dist/app", true},
+		{"", 0, "release", "release", true},
+		{"", 0, "", "", false},
+	}
+
+	for _, test := range tests {
+		opts := Options{StripComponents: test.strip, Prefix: test.prefix}
+		actual, ok := opts.Rename(test.name)
+		if actual != test.expected || ok != test.ok {
+			t.Errorf("Rename(%q) with strip %d and prefix %q = %q, %v, expected %q, %v", test.name, test.strip, test.prefix, actual, ok, test.expected, test.ok)
+		}
+	}
+}
+
+func TestNamerFlatten(t *testing.T) {
+	tests := []struct {
+		collision string
+		expected  []string
+		fail      bool
+	}{
+		{CollisionFail, []string{"lib/app.jar", "lib/core.jar"}, true},
+		{CollisionRename, []string{"lib/app.jar", "lib/core.jar", "lib/app-1.jar"}, false},
+		{CollisionOverwrite, []string{"lib/app.jar", "lib/core.jar", "lib/app.jar"}, false},
+	}
+
+	for _, test := range tests {
+		namer, err := NewNamer(Options{Flatten: true, FlattenCollision: test.collision, Prefix: "lib"})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if _, ok, _ := namer.Name("dist/", true); ok {
+			t.Errorf("expected directories to be left out")
+		}
+
+		var names []string
+		for _, name := range []string{"dist/app.jar", "dist/deps/core.jar", "dist/plugins/app.jar"} {
+			flat, _, err := namer.Name(name, false)
+			if err != nil {
+				if !test.fail {
+					t.Errorf("%s: expected no error, got %v", test.collision, err)
+				}
+				break
+			}
+			names = append(names, flat)
+		}
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.collision, test.expected, names)
+		}
+	}
+
+	if _, err := NewNamer(Options{Flatten: true, FlattenCollision: "merge"}); err == nil {
+		t.Errorf("expected an error for an unsupported collision")
+	}
+	if _, err := NewArchiveNamer(Options{Flatten: true, FlattenCollision: CollisionOverwrite}); err == nil {
+		t.Errorf("expected overwrite to be rejected when archiving")
+	}
+}
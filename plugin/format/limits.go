@@ -0,0 +1,129 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package format
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Limits bounds what an extraction may write, protecting the disk from
+// decompression bombs. Zero disables a limit.
+type Limits struct {
+	// MaxTotalSize and MaxFileSize are the uncompressed bytes of all
+	// entries and of any single entry.
+	MaxTotalSize int64
+	MaxFileSize  int64
+
+	// MaxEntries is the number of entries extracted.
+	MaxEntries int
+
+	// MaxRatio is the uncompressed bytes extracted per byte of the
+	// archive.
+	MaxRatio float64
+
+	// MaxDepth is the number of path components of an entry name.
+	MaxDepth int
+}
+
+// LimitError reports an extraction aborted because it exceeded one of its
+// Limits.
+type LimitError struct {
+	Entry string
+	Limit string
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("extraction aborted at %s: exceeds the %s", e.Entry, e.Limit)
+}
+
+// Aborted reports whether err ended an extraction early, because it
+// exceeded a limit or ctx is done. What was extracted so far is then
+// removed again.
+func Aborted(ctx context.Context, err error) bool {
+	var limitErr *LimitError
+	return err != nil && (ctx.Err() != nil || errors.As(err, &limitErr))
+}
+
+// Limiter enforces Limits on a single extraction.
+type Limiter struct {
+	limits      Limits
+	archiveSize int64
+	entries     int
+	total       int64
+}
+
+// NewLimiter returns a Limiter for extracting an archive of archiveSize
+// bytes.
+func NewLimiter(limits Limits, archiveSize int64) *Limiter {
+	return &Limiter{limits: limits, archiveSize: archiveSize}
+}
+
+// Entry counts an entry about to be extracted, checking its name and the
+// size it declares. The size actually read is checked by Reader.
+func (l *Limiter) Entry(name string, size int64) error {
+	l.entries++
+	if max := l.limits.MaxEntries; max > 0 && l.entries > max {
+		return &LimitError{name, fmt.Sprintf("maximum of %d entries", max)}
+	}
+	if max := l.limits.MaxDepth; max > 0 && depth(name) > max {
+		return &LimitError{name, fmt.Sprintf("maximum path depth of %d", max)}
+	}
+	if max := l.limits.MaxFileSize; max > 0 && size > max {
+		return &LimitError{name, fmt.Sprintf("maximum file size of %d bytes", max)}
+	}
+	return nil
+}
+
+// Reader returns a reader for the contents of the named entry that fails
+// with a LimitError once a size or ratio limit is exceeded.
+func (l *Limiter) Reader(name string, r io.Reader) io.Reader {
+	return &limitedReader{limiter: l, name: name, r: r}
+}
+
+func (l *Limiter) check(name string, size int64) error {
+	if max := l.limits.MaxFileSize; max > 0 && size > max {
+		return &LimitError{name, fmt.Sprintf("maximum file size of %d bytes", max)}
+	}
+	if max := l.limits.MaxTotalSize; max > 0 && l.total > max {
+		return &LimitError{name, fmt.Sprintf("maximum total size of %d bytes", max)}
+	}
+	if max := l.limits.MaxRatio; max > 0 && l.archiveSize > 0 && float64(l.total) > max*float64(l.archiveSize) {
+		return &LimitError{name, fmt.Sprintf("maximum compression ratio of %g", max)}
+	}
+	return nil
+}
+
+type limitedReader struct {
+	limiter *Limiter
+	name    string
+	r       io.Reader
+	size    int64
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.size += int64(n)
+	r.limiter.total += int64(n)
+
+	// Nothing past a limit is written
+	if limitErr := r.limiter.check(r.name, r.size); limitErr != nil {
+		return 0, limitErr
+	}
+	return n, err
+}
+
+func depth(name string) int {
+	var components int
+	for _, component := range strings.Split(name, "/") {
+		if component != "" && component != "." {
+			components++
+		}
+	}
+	return components
+}
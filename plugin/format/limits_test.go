@@ -0,0 +1,55 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package format
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLimiter(t *testing.T) {
+	content := strings.Repeat("a", 1000)
+
+	tests := []struct {
+		name   string
+		limits Limits
+		fail   bool
+	}{
+		{"no limits", Limits{}, false},
+		{"within limits", Limits{MaxTotalSize: 2000, MaxFileSize: 1000, MaxEntries: 2, MaxRatio: 20, MaxDepth: 2}, false},
+		{"total size", Limits{MaxTotalSize: 1500}, true},
+		{"file size", Limits{MaxFileSize: 999}, true},
+		{"entries", Limits{MaxEntries: 1}, true},
+		{"ratio", Limits{MaxRatio: 10}, true},
+		{"depth", Limits{MaxDepth: 1}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Two entries of 1000 bytes from a 100 byte archive
+			limiter := NewLimiter(test.limits, 100)
+
+			var err error
+			for _, name := range []string{"dir/a.txt", "dir/b.txt"} {
+				if err = limiter.Entry(name, 0); err != nil {
+					break
+				}
+				if _, err = io.Copy(io.Discard, limiter.Reader(name, strings.NewReader(content))); err != nil {
+					break
+				}
+			}
+
+			var limitErr *LimitError
+			if test.fail && !errors.As(err, &limitErr) {
+				t.Errorf("expected LimitError, got %v", err)
+			}
+			if !test.fail && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package format
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Ways to resolve the collision of two files with the same name in
+// flatten mode.
+const (
+	CollisionFail      = "fail"
+	CollisionRename    = "rename"
+	CollisionOverwrite = "overwrite"
+)
+
+// Namer assigns entry names when archiving or extracting, applying the
+// strip components, prefix and flatten settings of the options. Use a new
+// Namer for every archive.
+type Namer struct {
+	opts Options
+
+	// Names assigned in flatten mode, by original name
+	names map[string]string
+	taken map[string]bool
+}
+
+// NewNamer returns a Namer for opts.
+func NewNamer(opts Options) (*Namer, error) {
+	if opts.Flatten {
+		switch opts.FlattenCollision {
+		case "":
+			opts.FlattenCollision = CollisionFail
+		case CollisionFail, CollisionRename, CollisionOverwrite:
+		default:
+			return nil, fmt.Errorf("unsupported flatten collision: %s", opts.FlattenCollision)
+		}
+	}
+	return &Namer{
+		opts:  opts,
+		names: map[string]string{},
+		taken: map[string]bool{},
+	}, nil
+}
+
+// NewArchiveNamer returns a Namer for creating an archive with opts.
+// CollisionOverwrite is rejected, it would store several entries under the
+// same name, which many extraction tools refuse.
+func NewArchiveNamer(opts Options) (*Namer, error) {
+	if opts.Flatten && opts.FlattenCollision == CollisionOverwrite {
+		return nil, fmt.Errorf("flatten collision %s is only supported when extracting, use %s or %s to archive", CollisionOverwrite, CollisionFail, CollisionRename)
+	}
+	return NewNamer(opts)
+}
+
+// Name returns the name of the entry originally named name, a slash
+// separated path. It reports false if the entry is left out: when nothing
+// is left of the name after stripping components, or for directories in
+// flatten mode, where files keep their base name only.
+func (n *Namer) Name(name string, dir bool) (string, bool, error) {
+	if !n.opts.Flatten {
+		renamed, ok := n.opts.Rename(name)
+		return renamed, ok, nil
+	}
+	if dir {
+		return "", false, nil
+	}
+
+	base := path.Base(strings.TrimRight(name, "/"))
+	if base == "." || base == "/" {
+		return "", false, nil
+	}
+
+	if n.taken[base] {
+		switch n.opts.FlattenCollision {
+		case CollisionFail:
+			return "", false, fmt.Errorf("flatten: %s collides with an earlier file named %s", name, base)
+		case CollisionRename:
+			base = n.unique(base)
+		}
+	}
+	n.taken[base] = true
+
+	flat, _ := Options{Prefix: n.opts.Prefix}.Rename(base)
+	n.names[name] = flat
+	return flat, true, nil
+}
+
+// Link returns the name assigned to the entry originally named name, the
+// target of a hardlink. It reports false if the entry was left out.
+func (n *Namer) Link(name string) (string, bool) {
+	if !n.opts.Flatten {
+		return n.opts.Rename(name)
+	}
+	flat, ok := n.names[name]
+	return flat, ok
+}
+
+// unique numbers name, as in app-1.jar, until it is not taken.
+func (n *Namer) unique(name string) string {
+	stem, ext := splitExt(name)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s-%d%s", stem, i, ext)
+		if !n.taken[candidate] {
+			return candidate
+		}
+	}
+}
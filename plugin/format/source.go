@@ -0,0 +1,104 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package format
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Source is a file or directory to archive. Its contents are stored under
+// Prefix inside the archive.
+type Source struct {
+	Path   string
+	Prefix string
+}
+
+// ParseSource reads a source in the form "path" or "path=prefix".
+func ParseSource(s string) Source {
+	p, prefix, _ := strings.Cut(s, "=")
+	return Source{
+		Path:   strings.TrimSpace(p),
+		Prefix: strings.Trim(filepath.ToSlash(strings.TrimSpace(prefix)), "/"),
+	}
+}
+
+// Sources returns a Source without prefix for every path.
+func Sources(paths ...string) []Source {
+	sources := make([]Source, 0, len(paths))
+	for _, p := range paths {
+		sources = append(sources, Source{Path: p})
+	}
+	return sources
+}
+
+// Rel returns the slash separated path of the file at p, found while
+// walking the source, relative to the source. A source that is a single
+// file is named by its base name, the root of a directory source is
+// empty.
+func (s Source) Rel(p string, info os.FileInfo) string {
+	rel, err := filepath.Rel(s.Path, p)
+	if err != nil || rel == "." {
+		if info.IsDir() {
+			return ""
+		}
+		return filepath.Base(p)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// EntryName returns the archive name of the file at p, its path relative
+// to the source stored under the prefix.
+func (s Source) EntryName(p string, info os.FileInfo) string {
+	return path.Join(s.Prefix, s.Rel(p, info))
+}
+
+// Rename applies opts.StripComponents and opts.Prefix to the slash
+// separated entry name, when archiving or extracting. It reports false if
+// nothing is left of the name, like GNU tar skips entries with fewer
+// components than it strips.
+func (opts Options) Rename(name string) (string, bool) {
+	dir := strings.HasSuffix(name, "/")
+	name = strings.TrimRight(name, "/")
+	for strings.HasPrefix(name, "./") {
+		name = strings.TrimLeft(name[2:], "/")
+	}
+
+	if opts.StripComponents > 0 {
+		parts := strings.Split(name, "/")
+		if len(parts) <= opts.StripComponents {
+			return "", false
+		}
+		name = strings.Join(parts[opts.StripComponents:], "/")
+	}
+
+	if prefix := strings.Trim(opts.Prefix, "/"); prefix != "" {
+		if name == "" || name == "." {
+			name = prefix
+		} else {
+			name = prefix + "/" + name
+		}
+	}
+
+	if name == "" || name == "." {
+		return "", false
+	}
+	if dir {
+		name += "/"
+	}
+	return name, true
+}
+
+// SingleSource returns the path of the only source, for formats that
+// compress a single file.
+func SingleSource(sources []Source) (string, error) {
+	if len(sources) != 1 {
+		return "", fmt.Errorf("expected a single source, got %d", len(sources))
+	}
+	return sources[0].Path, nil
+}
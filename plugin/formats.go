@@ -0,0 +1,23 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"github.com/harness-community/drone-archive/plugin/compress"
+	"github.com/harness-community/drone-archive/plugin/format"
+
+	// Formats register themselves with the format package on import.
+	_ "github.com/harness-community/drone-archive/plugin/gzip"
+	_ "github.com/harness-community/drone-archive/plugin/tar"
+	_ "github.com/harness-community/drone-archive/plugin/zip"
+)
+
+func init() {
+	// Single files compressed with these algorithms share one format,
+	// gzip has its own for its header and directory support
+	for _, compression := range []string{compress.Zstd, compress.Xz, compress.Bzip2} {
+		format.Register(compression, format.CompressedFormat{Compression: compression})
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// AtomicFile is a temporary file that replaces its target once it is
+// committed, so the target is never seen partially written.
+type AtomicFile struct {
+	*os.File
+	target    string
+	committed bool
+}
+
+// CreateAtomic creates a temporary file next to target, in the same
+// directory so it can be renamed over it.
+func CreateAtomic(target string, perm os.FileMode) (*AtomicFile, error) {
+	file, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Chmod(perm); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return &AtomicFile{File: file, target: target}, nil
+}
+
+// Commit flushes the file to disk, closes it and renames it over the
+// target.
+func (f *AtomicFile) Commit() error {
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), f.target); err != nil {
+		return err
+	}
+	f.committed = true
+	return nil
+}
+
+// Cleanup closes and removes the temporary file unless it was committed,
+// leaving the target as it was. It is meant to be deferred.
+func (f *AtomicFile) Cleanup() {
+	if f.committed {
+		return
+	}
+	f.File.Close()
+	os.Remove(f.Name())
+}
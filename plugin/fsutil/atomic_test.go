@@ -0,0 +1,49 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAtomicFile(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "archive.zip")
+	os.WriteFile(target, []byte("previous"), 0644)
+
+	// A failed write leaves the previous target in place
+	file, err := CreateAtomic(target, 0644)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	file.WriteString("partial")
+	file.Cleanup()
+
+	if content, _ := os.ReadFile(target); string(content) != "previous" {
+		t.Errorf("expected the previous target to be kept, got %q", content)
+	}
+
+	file, err = CreateAtomic(target, 0644)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer file.Cleanup()
+	file.WriteString("complete")
+	if err := file.Commit(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if content, _ := os.ReadFile(target); string(content) != "complete" {
+		t.Errorf("expected the target to be replaced, got %q", content)
+	}
+	if info, _ := os.Stat(target); info.Mode().Perm() != 0644 {
+		t.Errorf("expected mode 0644, got %v", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected no temporary files to be left, got %v", entries)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// Copy copies from src to dst like io.Copy, but stops with the error of
+// ctx once it is done.
+func Copy(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	return io.Copy(dst, &contextReader{ctx: ctx, r: src})
+}
+
+// WriteFile creates the file at path with the contents of src. The file is
+// synced and closed before WriteFile returns, so extracting many entries
+// never holds more than one descriptor open. A partial file is removed
+// again when any step fails, including the close.
+func WriteFile(ctx context.Context, path string, src io.Reader, perm os.FileMode) (err error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+
+	if _, err := Copy(ctx, file, src); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
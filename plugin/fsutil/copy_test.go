@@ -0,0 +1,51 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCopy(t *testing.T) {
+	var buf bytes.Buffer
+	n, err := Copy(context.Background(), &buf, strings.NewReader("content"))
+	if err != nil || n != 7 || buf.String() != "content" {
+		t.Fatalf("expected content to be copied, got %d, %q, %v", n, buf.String(), err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Copy(ctx, io.Discard, strings.NewReader("content"))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := WriteFile(context.Background(), path, strings.NewReader("content"), 0600); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil || string(content) != "content" {
+		t.Fatalf("expected content to be written, got %q, %v", content, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := WriteFile(ctx, path, strings.NewReader("content"), 0600); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected partial file to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Created records the files and directories an extraction creates, so an
+// aborted extraction can remove them again without touching anything
+// that was there before. The zero value is ready to use.
+type Created struct {
+	paths []string
+}
+
+// MkdirAll creates the directory path and its parents like os.MkdirAll,
+// recording the directories that did not exist yet.
+func (c *Created) MkdirAll(path string, perm os.FileMode) error {
+	var missing []string
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		if _, err := os.Lstat(p); err == nil || filepath.Dir(p) == p {
+			break
+		}
+		missing = append(missing, p)
+	}
+	if err := os.MkdirAll(path, perm); err != nil {
+		return err
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		c.paths = append(c.paths, missing[i])
+	}
+	return nil
+}
+
+// Add records the file about to be created at path, unless something
+// already exists there.
+func (c *Created) Add(path string) {
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		c.paths = append(c.paths, path)
+	}
+}
+
+// Remove removes everything recorded, the most recent first so files go
+// before their directories. Errors are ignored, a directory that is not
+// empty is left in place.
+func (c *Created) Remove() {
+	for i := len(c.paths) - 1; i >= 0; i-- {
+		os.Remove(c.paths[i])
+	}
+	c.paths = nil
+}
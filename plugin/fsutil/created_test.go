@@ -0,0 +1,40 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreated(t *testing.T) {
+	root := t.TempDir()
+	existing := filepath.Join(root, "existing.txt")
+	os.WriteFile(existing, []byte("existing"), 0644)
+
+	var created Created
+	dir := filepath.Join(root, "a", "b")
+	if err := created.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	file := filepath.Join(dir, "file.txt")
+	created.Add(file)
+	os.WriteFile(file, []byte("new"), 0644)
+	created.Add(existing)
+	os.WriteFile(existing, []byte("overwritten"), 0644)
+
+	created.Remove()
+
+	if _, err := os.Stat(filepath.Join(root, "a")); !os.IsNotExist(err) {
+		t.Errorf("expected created directories to be removed, got %v", err)
+	}
+	if _, err := os.Stat(existing); err != nil {
+		t.Errorf("expected the existing file to be kept, got %v", err)
+	}
+	if _, err := os.Stat(root); err != nil {
+		t.Errorf("expected the root to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Preserve selects the file attributes restored on extraction.
+type Preserve struct {
+	Permissions bool
+	Times       bool
+
+	// Owner restores uid and gid. It only takes effect when running as
+	// root, since other users cannot give files away.
+	Owner bool
+}
+
+// Metadata holds the attributes recorded for an archive entry.
+type Metadata struct {
+	Mode       os.FileMode
+	ModTime    time.Time
+	AccessTime time.Time
+	Uid        int
+	Gid        int
+}
+
+// Restore applies the attributes selected by p to path. A zero
+// AccessTime leaves the access time unchanged. Symlinks are never
+// followed, only their ownership is restored.
+func (p Preserve) Restore(path string, md Metadata) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	isLink := info.Mode()&os.ModeSymlink != 0
+
+	// Ownership goes first since chown clears the setuid and setgid bits
+	if p.Owner && os.Geteuid() == 0 {
+		if err := os.Lchown(path, md.Uid, md.Gid); err != nil {
+			return fmt.Errorf("failed to restore owner of %s: %w", path, err)
+		}
+	}
+
+	if isLink {
+		return nil
+	}
+
+	if p.Permissions {
+		mode := md.Mode & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		if err := os.Chmod(path, mode); err != nil {
+			return fmt.Errorf("failed to restore permissions of %s: %w", path, err)
+		}
+	}
+
+	if p.Times {
+		if err := os.Chtimes(path, md.AccessTime, md.ModTime); err != nil {
+			return fmt.Errorf("failed to restore times of %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// PendingDirs collects the directories of an archive whose attributes are
+// restored once everything is extracted, since extracting their contents
+// would otherwise change the modification time again. The zero value is
+// ready to use.
+type PendingDirs struct {
+	dirs []pendingDir
+}
+
+type pendingDir struct {
+	path string
+	md   Metadata
+}
+
+// Add records the directory extracted to path with the attributes md.
+func (d *PendingDirs) Add(path string, md Metadata) {
+	d.dirs = append(d.dirs, pendingDir{path, md})
+}
+
+// Restore applies the attributes selected by p to every directory added,
+// the last added first so that nested directories precede their parents.
+func (d *PendingDirs) Restore(p Preserve) error {
+	for i := len(d.dirs) - 1; i >= 0; i-- {
+		if err := p.Restore(d.dirs[i].path, d.dirs[i].md); err != nil {
+			return err
+		}
+	}
+	return nil
+}
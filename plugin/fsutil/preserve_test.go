@@ -0,0 +1,95 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestPreserveRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tool")
+	if err := os.WriteFile(path, []byte("#!/bin/sh"), 0600); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	atime := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	preserve := Preserve{Permissions: true, Times: true, Owner: true}
+	err := preserve.Restore(path, Metadata{
+		Mode:       0755,
+		ModTime:    mtime,
+		AccessTime: atime,
+		Uid:        os.Getuid(),
+		Gid:        os.Getgid(),
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat file: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0755 {
+		t.Errorf("expected mode 0755, got %v", info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("expected mtime %v, got %v", mtime, info.ModTime())
+	}
+}
+
+func TestPreserveRestoreDoesNotFollowSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	outside := filepath.Join(dir, "outside")
+	if err := os.WriteFile(outside, nil, 0600); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(outside, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	preserve := Preserve{Permissions: true, Times: true}
+	if err := preserve.Restore(link, Metadata{Mode: 0777, ModTime: time.Unix(0, 0)}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	info, _ := os.Stat(outside)
+	if info.Mode().Perm() != 0600 || info.ModTime().Equal(time.Unix(0, 0)) {
+		t.Errorf("expected symlink target to be left untouched")
+	}
+}
+
+func TestPendingDirsRestore(t *testing.T) {
+	root := t.TempDir()
+	parent := filepath.Join(root, "a")
+	child := filepath.Join(parent, "b")
+	if err := os.MkdirAll(child, 0755); err != nil {
+		t.Fatalf("failed to create directories: %v", err)
+	}
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var dirs PendingDirs
+	dirs.Add(parent, Metadata{Mode: os.ModeDir | 0755, ModTime: mtime})
+	dirs.Add(child, Metadata{Mode: os.ModeDir | 0755, ModTime: mtime.Add(time.Hour)})
+
+	if err := dirs.Restore(Preserve{Times: true}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for path, expected := range map[string]time.Time{parent: mtime, child: mtime.Add(time.Hour)} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("failed to stat directory: %v", err)
+		}
+		if !info.ModTime().Equal(expected) {
+			t.Errorf("expected mtime %v for %s, got %v", expected, path, info.ModTime())
+		}
+	}
+}
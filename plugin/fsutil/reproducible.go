@@ -0,0 +1,38 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"os"
+	"time"
+)
+
+// DefaultEpoch is the timestamp reproducible archives are clamped to when
+// SOURCE_DATE_EPOCH is not set. It is the earliest time a zip entry can
+// record.
+var DefaultEpoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ClampTime returns t, or epoch if t is later than epoch, truncated to
+// whole seconds in UTC.
+func ClampTime(t, epoch time.Time) time.Time {
+	if t.After(epoch) {
+		t = epoch
+	}
+	return t.Truncate(time.Second).UTC()
+}
+
+// NormalizeMode keeps the file type of mode and replaces its permissions
+// with 0777 for symlinks, 0755 for directories and executables and 0644
+// for everything else.
+func NormalizeMode(mode os.FileMode) os.FileMode {
+	if mode&os.ModeSymlink != 0 {
+		return os.ModeSymlink | 0777
+	}
+	perm := os.FileMode(0644)
+	if mode.IsDir() || mode&0111 != 0 {
+		perm = 0755
+	}
+	return mode&os.ModeType | perm
+}
@@ -0,0 +1,42 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestClampTime(t *testing.T) {
+	epoch := time.Unix(1000, 0)
+
+	if actual := ClampTime(time.Unix(2000, 0), epoch); !actual.Equal(epoch) {
+		t.Errorf("expected later time to be clamped to %v, got %v", epoch, actual)
+	}
+	if actual := ClampTime(time.Unix(500, 999), epoch); !actual.Equal(time.Unix(500, 0)) {
+		t.Errorf("expected earlier time to be kept and truncated, got %v", actual)
+	}
+}
+
+func TestNormalizeMode(t *testing.T) {
+	tests := []struct {
+		mode     os.FileMode
+		expected os.FileMode
+	}{
+		{0600, 0644},
+		{0664, 0644},
+		{0700, 0755},
+		{0744, 0755},
+		{os.ModeDir | 0700, os.ModeDir | 0755},
+		{os.ModeSymlink | 0755, os.ModeSymlink | 0777},
+	}
+
+	for _, test := range tests {
+		if actual := NormalizeMode(test.mode); actual != test.expected {
+			t.Errorf("NormalizeMode(%v) = %v, expected %v", test.mode, actual, test.expected)
+		}
+	}
+}
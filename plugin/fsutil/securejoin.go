@@ -0,0 +1,118 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// UnsafePathError reports an archive entry that would be written outside
+// of the extraction directory.
+type UnsafePathError struct {
+	Entry  string
+	Reason string
+}
+
+func (e *UnsafePathError) Error() string {
+	return fmt.Sprintf("unsafe archive entry %q: %s", e.Entry, e.Reason)
+}
+
+// SecureJoin joins the archive entry name to root and returns the result
+// if it stays inside root. Absolute names, names that climb out of root
+// with "..", and names whose parent directories pass through an existing
+// symlink pointing outside of root are rejected with an *UnsafePathError.
+//
+// The last path component is not resolved. Callers replace an existing
+// file at that path, see RemoveExisting, rather than write through it.
+func SecureJoin(root, name string) (string, error) {
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") || filepath.VolumeName(name) != "" {
+		return "", &UnsafePathError{Entry: name, Reason: "absolute path"}
+	}
+
+	cleaned := filepath.Clean(filepath.FromSlash(name))
+	if cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", &UnsafePathError{Entry: name, Reason: "path escapes target directory"}
+	}
+
+	realRoot, err := resolveRoot(root)
+	if err != nil {
+		return "", err
+	}
+
+	// Walk the parent directories that already exist on disk. A symlink
+	// planted by an earlier entry must not redirect later writes outside
+	// of root.
+	parts := strings.Split(cleaned, string(filepath.Separator))
+	current := root
+	for _, part := range parts[:len(parts)-1] {
+		current = filepath.Join(current, part)
+
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+
+		// A relative root resolves to a relative path, compare it in its
+		// absolute form like realRoot
+		resolved, err := filepath.EvalSymlinks(current)
+		if err == nil {
+			resolved, err = filepath.Abs(resolved)
+		}
+		if err != nil || !Within(realRoot, resolved) {
+			return "", &UnsafePathError{Entry: name, Reason: "path traverses a symlink outside target directory"}
+		}
+	}
+
+	return filepath.Join(root, cleaned), nil
+}
+
+// resolveRoot returns the absolute, symlink free form of root so it can be
+// compared with resolved entry paths.
+func resolveRoot(root string) (string, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if os.IsNotExist(err) {
+		return abs, nil
+	}
+	return resolved, err
+}
+
+// Within reports whether path is root or lies below it. Both paths must
+// be absolute or both relative.
+func Within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// RemoveExisting removes the file or symlink at path so
+// a new entry can be created in its place. A missing path is not an error.
+func RemoveExisting(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+	return os.Remove(path)
+}
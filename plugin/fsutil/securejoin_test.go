@@ -0,0 +1,93 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecureJoin(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	if err := os.Mkdir(filepath.Join(root, "dir"), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	if err := os.Symlink("dir", filepath.Join(root, "inside")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		entry  string
+		unsafe bool
+	}{
+		{"plain file", "file.txt", false},
+		{"nested file", "dir/file.txt", false},
+		{"dot segments inside root", "dir/../file.txt", false},
+		{"symlink inside root", "inside/file.txt", false},
+		{"symlink as last component", "escape", false},
+		{"parent escape", "../file.txt", true},
+		{"nested parent escape", "dir/../../file.txt", true},
+		{"absolute path", "/etc/passwd", true},
+		{"symlink escape", "escape/file.txt", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path, err := SecureJoin(root, test.entry)
+			if !test.unsafe {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if !Within(root, path) {
+					t.Errorf("expected %s to be inside %s", path, root)
+				}
+				return
+			}
+
+			var unsafe *UnsafePathError
+			if !errors.As(err, &unsafe) {
+				t.Fatalf("expected UnsafePathError, got %v", err)
+			}
+			if unsafe.Entry != test.entry {
+				t.Errorf("expected entry %q in error, got %q", test.entry, unsafe.Entry)
+			}
+		})
+	}
+}
+
+func TestSecureJoinRelativeRoot(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "out", "real"), 0755)
+	os.Symlink("real", filepath.Join(dir, "out", "link"))
+	os.Symlink(outside, filepath.Join(dir, "out", "escape"))
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer os.Chdir(wd)
+
+	path, err := SecureJoin("out", "link/file.txt")
+	if err != nil || path != filepath.Join("out", "link", "file.txt") {
+		t.Errorf("expected a symlink inside a relative root to be allowed, got %q, %v", path, err)
+	}
+
+	var unsafe *UnsafePathError
+	if _, err := SecureJoin("out", "escape/file.txt"); !errors.As(err, &unsafe) {
+		t.Errorf("expected UnsafePathError, got %v", err)
+	}
+}
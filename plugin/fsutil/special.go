@@ -0,0 +1,12 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package fsutil
+
+// FileID identifies a file on disk independently of its name, so that
+// hardlinks to the same file can be recognized.
+type FileID struct {
+	Dev uint64
+	Ino uint64
+}
@@ -0,0 +1,40 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+//go:build !windows
+
+package fsutil
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// HardlinkID returns the identity of the file described by info if it
+// has more than one hardlink.
+func HardlinkID(info os.FileInfo) (FileID, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Nlink < 2 {
+		return FileID{}, false
+	}
+	return FileID{Dev: uint64(stat.Dev), Ino: uint64(stat.Ino)}, true
+}
+
+// Mkfifo creates a named pipe at path.
+func Mkfifo(path string, perm os.FileMode) error {
+	return unix.Mkfifo(path, uint32(perm.Perm()))
+}
+
+// Mknod creates a character device if mode has os.ModeCharDevice set and
+// a block device otherwise.
+func Mknod(path string, mode os.FileMode, major, minor int64) error {
+	kind := uint32(unix.S_IFBLK)
+	if mode&os.ModeCharDevice != 0 {
+		kind = unix.S_IFCHR
+	}
+	dev := unix.Mkdev(uint32(major), uint32(minor))
+	return unix.Mknod(path, kind|uint32(mode.Perm()), int(dev))
+}
@@ -0,0 +1,28 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+//go:build windows
+
+package fsutil
+
+import (
+	"errors"
+	"os"
+)
+
+// HardlinkID always reports false on Windows, hardlinks are archived as
+// separate files.
+func HardlinkID(info os.FileInfo) (FileID, bool) {
+	return FileID{}, false
+}
+
+// Mkfifo is not supported on Windows.
+func Mkfifo(path string, perm os.FileMode) error {
+	return errors.ErrUnsupported
+}
+
+// Mknod is not supported on Windows.
+func Mknod(path string, mode os.FileMode, major, minor int64) error {
+	return errors.ErrUnsupported
+}
@@ -6,69 +6,372 @@ package gzip
 
 import (
 	"compress/gzip"
+	"context"
 	"fmt"
-	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/harness-community/drone-archive/plugin/compress"
+	"github.com/harness-community/drone-archive/plugin/format"
+	"github.com/harness-community/drone-archive/plugin/fsutil"
+	"github.com/harness-community/drone-archive/plugin/match"
 )
 
-func GzipFile(source, target string) error {
-	// Ensure the target directory exists
-	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
-		return fmt.Errorf("failed to create target directory: %w", err)
+func init() {
+	format.Register("gzip", gzipFormat{})
+}
+
+type gzipFormat struct{}
+
+func (g gzipFormat) Archive(ctx context.Context, sources []format.Source, target string, opts format.Options) error {
+	if g.Batch(sources) {
+		return GzipFiles(ctx, sources, target, opts)
+	}
+	source, err := format.SingleSource(sources)
+	if err != nil {
+		return err
+	}
+	return GzipFile(ctx, source, target, opts)
+}
+
+// Batch reports whether the sources select several files to compress
+// each on its own: more than one source, a directory or a glob.
+func (gzipFormat) Batch(sources []format.Source) bool {
+	if len(sources) != 1 {
+		return len(sources) > 1
+	}
+	info, err := os.Stat(sources[0].Path)
+	if err != nil {
+		// A source that does not exist may be a glob
+		return isGlob(sources[0].Path)
+	}
+	return info.IsDir()
+}
+
+func (gzipFormat) Extract(ctx context.Context, source, target string, opts format.Options) error {
+	if info, err := os.Stat(source); err == nil && info.IsDir() {
+		return GunzipDir(ctx, source, target, opts)
+	}
+	return GunzipFile(ctx, source, target, opts)
+}
+
+func (gzipFormat) List(ctx context.Context, source string, opts format.Options) ([]format.Entry, error) {
+	return List(ctx, source, opts)
+}
+
+func (gzipFormat) Test(ctx context.Context, source string, opts format.Options) error {
+	return format.TestCompressed(ctx, source, compress.Gzip)
+}
+
+// GzipFile compresses the file at source to target, recording its name
+// and modification time in the gzip header like gzip -N.
+func GzipFile(ctx context.Context, source, target string, opts format.Options) error {
+	return format.CompressFile(ctx, source, target, compress.Gzip, opts)
+}
+
+// GzipFiles compresses every file selected by the sources, walking
+// directories and expanding globs, to its own <name>.gz like gzip -r. The
+// compressed files are written below target, keeping their path relative
+// to the source, or next to the originals if target is empty. Unlike gzip
+// the originals are kept, and files already ending in .gz are skipped.
+func GzipFiles(ctx context.Context, sources []format.Source, target string, opts format.Options) error {
+	files, err := selectFiles(ctx, sources, opts)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no files selected to compress")
+	}
+
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		out := file.path + ".gz"
+		if target != "" {
+			out = filepath.Join(target, filepath.FromSlash(file.name)+".gz")
+		}
+
+		// Handle an existing file according to the conflict policy, newer
+		// only compresses files changed since they were last compressed
+		resolved, err := opts.ResolveConflict(out, file.info.ModTime())
+		if err != nil {
+			return err
+		}
+		if resolved == "" {
+			fmt.Printf("Skipping existing file: %s\n", out)
+			continue
+		}
+
+		if err := GzipFile(ctx, file.path, resolved, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inputFile is a regular file selected for compression or decompression.
+type inputFile struct {
+	path string
+	name string // slash separated, relative to its source
+	info os.FileInfo
+}
+
+// selectFiles returns the regular files of the sources that are selected
+// by the glob, exclude and ignore settings.
+func selectFiles(ctx context.Context, sources []format.Source, opts format.Options) ([]inputFile, error) {
+	var files []inputFile
+	for _, source := range sources {
+		filter, err := format.NewFilter(opts)
+		if err != nil {
+			return nil, err
+		}
+
+		add := func(name, p string, info os.FileInfo) error {
+			ok, err := filter.Visit(name, p, info)
+			if err != nil || !ok || !info.Mode().IsRegular() {
+				return err
+			}
+			if isGzip(name) {
+				fmt.Printf("Skipping already compressed file: %s\n", p)
+				return nil
+			}
+			files = append(files, inputFile{p, path.Join(source.Prefix, name), info})
+			return nil
+		}
+
+		if _, err := os.Stat(source.Path); err != nil && isGlob(source.Path) {
+			base, pattern := doublestar.SplitPattern(filepath.ToSlash(source.Path))
+			matches, err := doublestar.Glob(os.DirFS(base), pattern, doublestar.WithFilesOnly())
+			if err != nil {
+				return nil, fmt.Errorf("invalid source pattern %s: %w", source.Path, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %s", source.Path)
+			}
+			for _, match := range matches {
+				p := filepath.Join(base, filepath.FromSlash(match))
+				info, err := os.Lstat(p)
+				if err != nil {
+					return nil, err
+				}
+				if err := add(match, p, info); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		err = filepath.Walk(source.Path, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return add(source.Rel(p, info), p, info)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func isGlob(p string) bool {
+	return strings.ContainsAny(p, "*?[{")
+}
+
+func isGzip(name string) bool {
+	return strings.HasSuffix(name, ".gz")
+}
+
+// List returns the single entry of the gzip file at source if it matches
+// the glob patterns. It is named and timed after the original file
+// recorded in the gzip header, like gzip -l -N.
+func List(ctx context.Context, source string, opts format.Options) ([]format.Entry, error) {
+	header, err := readHeader(source)
+	if err != nil {
+		return nil, err
+	}
+	name, err := originalName(source, header)
+	if err != nil {
+		name = filepath.Base(source)
+	}
+	if !match.Selected(name, opts.Globs, nil) {
+		return nil, nil
+	}
+
+	entries, err := format.ListCompressed(ctx, source, compress.Gzip, format.Options{})
+	if err != nil {
+		return nil, err
 	}
+	entries[0].Name = name
+	if !header.ModTime.IsZero() {
+		entries[0].ModTime = header.ModTime
+	}
+	return entries, nil
+}
 
+// readHeader reads the header of the gzip file at source.
+func readHeader(source string) (gzip.Header, error) {
 	in, err := os.Open(source)
 	if err != nil {
-		return fmt.Errorf("failed to open source file: %w", err)
+		return gzip.Header{}, fmt.Errorf("failed to open source file: %w", err)
 	}
 	defer in.Close()
 
-	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	reader, err := gzip.NewReader(in)
 	if err != nil {
-		return fmt.Errorf("failed to create target file: %w", err)
+		return gzip.Header{}, fmt.Errorf("failed to create gzip reader: %w", err)
 	}
-	defer out.Close()
+	return reader.Header, nil
+}
 
-	writer := gzip.NewWriter(out)
-	defer writer.Close()
+// GunzipDir restores every .gz file below the source directory that is
+// selected by the glob and exclude patterns. The files are written below
+// target, keeping their path relative to source without the extension,
+// or next to the compressed files if target is empty, with the
+// modification time recorded in their header like gzip -N. The limits
+// apply to the directory as a whole.
+func GunzipDir(ctx context.Context, source, target string, opts format.Options) error {
+	filter, err := format.NewFilter(opts)
+	if err != nil {
+		return err
+	}
 
-	_, err = io.Copy(writer, in)
+	var files []inputFile
+	var size int64
+	root := format.Source{Path: source}
+	err = filepath.Walk(source, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := root.Rel(p, info)
+		ok, err := filter.Visit(name, p, info)
+		if err != nil || !ok || !info.Mode().IsRegular() || !isGzip(name) {
+			return err
+		}
+		files = append(files, inputFile{p, name, info})
+		size += info.Size()
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to compress file: %w", err)
+		return err
 	}
 
+	limiter := format.NewLimiter(opts.Limits, size)
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		name := strings.TrimSuffix(file.name, ".gz")
+		if err := limiter.Entry(name, 0); err != nil {
+			return err
+		}
+
+		out := strings.TrimSuffix(file.path, ".gz")
+		if target != "" {
+			if out, err = fsutil.SecureJoin(target, name); err != nil {
+				return err
+			}
+		}
+
+		if err := gunzip(ctx, file.path, out, true, opts, limiter); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func GunzipFile(source, target string) error {
-	// Ensure the target directory exists
-	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
-		return fmt.Errorf("failed to create target directory: %w", err)
-	}
+// GunzipFile decompresses source to target. If target is empty or a
+// directory, the file is named after the original name recorded in the
+// gzip header, or the source without its .gz extension, and its
+// modification time is restored from the header, like gzip -N. Empty
+// writes next to source.
+func GunzipFile(ctx context.Context, source, target string, opts format.Options) error {
+	return gunzip(ctx, source, target, false, opts, nil)
+}
 
+// gunzip decompresses source to target, counting what it writes against
+// limiter, or against limits of its own if limiter is nil. The
+// modification time recorded in the header is restored if restoreTime is
+// set, the target is derived from the header, or times are preserved.
+func gunzip(ctx context.Context, source, target string, restoreTime bool, opts format.Options, limiter *format.Limiter) error {
 	in, err := os.Open(source)
 	if err != nil {
 		return fmt.Errorf("failed to open source file: %w", err)
 	}
 	defer in.Close()
 
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
 	reader, err := gzip.NewReader(in)
 	if err != nil {
 		return fmt.Errorf("failed to create gzip reader: %w", err)
 	}
 	defer reader.Close()
 
-	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to create target file: %w", err)
+	// Name the file after the header when only a directory is given
+	dir := target
+	if dir == "" {
+		dir = filepath.Dir(source)
+	}
+	if stat, err := os.Stat(dir); target == "" || (err == nil && stat.IsDir()) {
+		name, err := originalName(source, reader.Header)
+		if err != nil {
+			return err
+		}
+		target = filepath.Join(dir, name)
+		restoreTime = true
 	}
-	defer out.Close()
 
-	_, err = io.Copy(out, reader)
-	if err != nil {
-		return fmt.Errorf("failed to decompress file: %w", err)
+	// newer compares against the time of the original file if it is
+	// recorded
+	modTime := reader.Header.ModTime
+	if modTime.IsZero() {
+		modTime = info.ModTime()
+	}
+	if limiter == nil {
+		limiter = format.NewLimiter(opts.Limits, info.Size())
+	}
+	target, err = format.WriteDecompressed(ctx, reader, target, modTime, opts, limiter)
+	if err != nil || target == "" {
+		return err
 	}
 
+	// Restore the modification time recorded in the header
+	if modTime := reader.Header.ModTime; !modTime.IsZero() && (restoreTime || opts.Preserve.Times) {
+		if err := os.Chtimes(target, modTime, modTime); err != nil {
+			return fmt.Errorf("failed to restore modification time of %s: %w", target, err)
+		}
+	}
 	return nil
 }
+
+// originalName returns the file name recorded in the gzip header, or the
+// base name of source without its .gz extension if there is none, see
+// format.CompressedName. Only
+// the base name of the header is used, so it cannot point elsewhere.
+func originalName(source string, header gzip.Header) (string, error) {
+	name := path.Base(strings.ReplaceAll(header.Name, "\\", "/"))
+	if name != "." && name != "/" && name != ".." {
+		return name, nil
+	}
+
+	if name := format.CompressedName(source, compress.Gzip); name != filepath.Base(source) && name != "" {
+		return name, nil
+	}
+	return "", fmt.Errorf("no file name recorded in %s, set a target", source)
+}
@@ -1,10 +1,16 @@
 package gzip
 
 import (
+	"compress/gzip"
+	"context"
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/harness-community/drone-archive/plugin/format"
 )
 
 func createTestFile(t *testing.T, content string) string {
@@ -31,7 +37,7 @@ func TestGzipFile(t *testing.T) {
 	gzipFile := filepath.Join(os.TempDir(), "testfile.gz")
 	defer os.Remove(gzipFile)
 
-	err := GzipFile(sourceFile, gzipFile)
+	err := GzipFile(context.Background(), sourceFile, gzipFile, format.Options{})
 	if err != nil {
 		t.Fatalf("GzipFile() error = %v", err)
 	}
@@ -49,7 +55,7 @@ func TestGunzipFile(t *testing.T) {
 	gzipFile := filepath.Join(os.TempDir(), "testfile.gz")
 	defer os.Remove(gzipFile)
 
-	err := GzipFile(sourceFile, gzipFile)
+	err := GzipFile(context.Background(), sourceFile, gzipFile, format.Options{})
 	if err != nil {
 		t.Fatalf("GzipFile() error = %v", err)
 	}
@@ -57,7 +63,7 @@ func TestGunzipFile(t *testing.T) {
 	unzippedFile := filepath.Join(os.TempDir(), "testfile_unzipped.txt")
 	defer os.Remove(unzippedFile)
 
-	err = GunzipFile(gzipFile, unzippedFile)
+	err = GunzipFile(context.Background(), gzipFile, unzippedFile, format.Options{})
 	if err != nil {
 		t.Fatalf("GunzipFile() error = %v", err)
 	}
@@ -82,7 +88,7 @@ func TestGzipGunzipConsistency(t *testing.T) {
 	gzipFile := filepath.Join(os.TempDir(), "testfile.gz")
 	defer os.Remove(gzipFile)
 
-	err := GzipFile(sourceFile, gzipFile)
+	err := GzipFile(context.Background(), sourceFile, gzipFile, format.Options{})
 	if err != nil {
 		t.Fatalf("GzipFile() error = %v", err)
 	}
@@ -90,7 +96,7 @@ func TestGzipGunzipConsistency(t *testing.T) {
 	unzippedFile := filepath.Join(os.TempDir(), "testfile_unzipped.txt")
 	defer os.Remove(unzippedFile)
 
-	err = GunzipFile(gzipFile, unzippedFile)
+	err = GunzipFile(context.Background(), gzipFile, unzippedFile, format.Options{})
 	if err != nil {
 		t.Fatalf("GunzipFile() error = %v", err)
 	}
@@ -105,3 +111,263 @@ func TestGzipGunzipConsistency(t *testing.T) {
 		t.Errorf("expected content %q, got %q", expectedContent, string(actualContent))
 	}
 }
+
+func TestGzipList(t *testing.T) {
+	sourceFile := createTestFile(t, "This is a test file content")
+	defer os.Remove(sourceFile)
+
+	gzipFile := filepath.Join(os.TempDir(), "testfile_list.txt.gz")
+	defer os.Remove(gzipFile)
+
+	if err := GzipFile(context.Background(), sourceFile, gzipFile, format.Options{}); err != nil {
+		t.Fatalf("GzipFile() error = %v", err)
+	}
+
+	entries, err := gzipFormat{}.List(context.Background(), gzipFile, format.Options{})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	// The entry is named and timed after the original file in the header
+	info, _ := os.Stat(sourceFile)
+	if len(entries) != 1 || entries[0].Name != filepath.Base(sourceFile) || entries[0].Size != int64(len("This is a test file content")) {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	if !entries[0].ModTime.Equal(info.ModTime().Truncate(time.Second)) {
+		t.Errorf("expected modification time %v, got %v", info.ModTime(), entries[0].ModTime)
+	}
+}
+
+func TestGzipTest(t *testing.T) {
+	sourceFile := createTestFile(t, "This is a test file content")
+	defer os.Remove(sourceFile)
+
+	gzipFile := filepath.Join(os.TempDir(), "testfile_test.txt.gz")
+	defer os.Remove(gzipFile)
+
+	if err := GzipFile(context.Background(), sourceFile, gzipFile, format.Options{}); err != nil {
+		t.Fatalf("GzipFile() error = %v", err)
+	}
+
+	if err := (gzipFormat{}).Test(context.Background(), gzipFile, format.Options{}); err != nil {
+		t.Fatalf("Test() error = %v", err)
+	}
+
+	content, _ := ioutil.ReadFile(gzipFile)
+	content[len(content)-8] ^= 0xff
+	ioutil.WriteFile(gzipFile, content, 0644)
+
+	var corrupted *format.CorruptError
+	if err := (gzipFormat{}).Test(context.Background(), gzipFile, format.Options{}); !errors.As(err, &corrupted) {
+		t.Errorf("expected CorruptError, got %v", err)
+	}
+}
+
+func TestGunzipFileRatioLimit(t *testing.T) {
+	dir := t.TempDir()
+	sourceFile := filepath.Join(dir, "zeros")
+	if err := ioutil.WriteFile(sourceFile, make([]byte, 1<<20), 0644); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	gzipFile := filepath.Join(dir, "zeros.gz")
+	if err := GzipFile(context.Background(), sourceFile, gzipFile, format.Options{}); err != nil {
+		t.Fatalf("GzipFile() error = %v", err)
+	}
+
+	target := filepath.Join(dir, "out")
+	opts := format.Options{Limits: format.Limits{MaxRatio: 10}}
+	var limited *format.LimitError
+	if err := GunzipFile(context.Background(), gzipFile, target, opts); !errors.As(err, &limited) {
+		t.Fatalf("expected LimitError, got %v", err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("expected no target after an aborted extraction, got %v", err)
+	}
+}
+
+func TestGzipFilesDirectory(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "site")
+	for name, content := range map[string]string{
+		"index.html":       "<html></html>",
+		"css/app.css":      "body {}",
+		"js/app.js":        "app()",
+		"js/vendor.js.gz":  "already compressed",
+		"images/logo.webp": "image",
+	} {
+		path := filepath.Join(source, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	f := gzipFormat{}
+	sources := format.Sources(source)
+	if !f.Batch(sources) {
+		t.Fatalf("expected a directory source to be a batch")
+	}
+
+	// Compress in place, leaving the originals
+	opts := format.Options{Excludes: []string{"images/"}}
+	if err := f.Archive(context.Background(), sources, "", opts); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, name := range []string{"index.html", "css/app.css", "js/app.js"} {
+		path := filepath.Join(source, filepath.FromSlash(name))
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected original %s to be kept, got %v", name, err)
+		}
+		if _, err := os.Stat(path + ".gz"); err != nil {
+			t.Errorf("expected %s.gz, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"js/vendor.js.gz.gz", "images/logo.webp.gz"} {
+		if _, err := os.Stat(filepath.Join(source, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			t.Errorf("expected no %s, got %v", name, err)
+		}
+	}
+
+	// Compress a glob into a target directory
+	target := filepath.Join(dir, "out")
+	sources = format.Sources(filepath.Join(source, "**", "*.js"))
+	if err := f.Archive(context.Background(), sources, target, format.Options{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "js", "app.js.gz")); err != nil {
+		t.Errorf("expected js/app.js.gz in the target, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "index.html.gz")); !os.IsNotExist(err) {
+		t.Errorf("expected index.html to be left out, got %v", err)
+	}
+}
+
+func TestGunzipDir(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "site")
+	os.MkdirAll(filepath.Join(source, "js"), 0755)
+	input := filepath.Join(dir, "app.js")
+	ioutil.WriteFile(input, []byte("app()"), 0644)
+	modTime := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	os.Chtimes(input, modTime, modTime)
+	if err := GzipFile(context.Background(), input, filepath.Join(source, "js", "app.js.gz"), format.Options{}); err != nil {
+		t.Fatalf("GzipFile() error = %v", err)
+	}
+
+	target := filepath.Join(dir, "out")
+	if err := (gzipFormat{}).Extract(context.Background(), source, target, format.Options{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(target, "js", "app.js"))
+	if err != nil || string(content) != "app()" {
+		t.Errorf("expected js/app.js to be restored, got %q, %v", content, err)
+	}
+	if info, err := os.Stat(filepath.Join(target, "js", "app.js")); err != nil || !info.ModTime().Equal(modTime) {
+		t.Errorf("expected modification time %v from the header, got %v", modTime, info)
+	}
+
+	// Restore in place
+	if err := (gzipFormat{}).Extract(context.Background(), source, "", format.Options{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(source, "js", "app.js")); err != nil {
+		t.Errorf("expected js/app.js next to the compressed file, got %v", err)
+	}
+}
+
+func TestGzipHeaderNameAndModTime(t *testing.T) {
+	dir := t.TempDir()
+	sourceFile := filepath.Join(dir, "report.txt")
+	ioutil.WriteFile(sourceFile, []byte("report"), 0644)
+	modTime := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	os.Chtimes(sourceFile, modTime, modTime)
+
+	// The compressed name does not tell the original name
+	gzipFile := filepath.Join(dir, "upload.bin.gz")
+	if err := GzipFile(context.Background(), sourceFile, gzipFile, format.Options{}); err != nil {
+		t.Fatalf("GzipFile() error = %v", err)
+	}
+
+	// A directory target is named and timed after the header
+	target := filepath.Join(dir, "out")
+	os.Mkdir(target, 0755)
+	if err := GunzipFile(context.Background(), gzipFile, target, format.Options{}); err != nil {
+		t.Fatalf("GunzipFile() error = %v", err)
+	}
+	info, err := os.Stat(filepath.Join(target, "report.txt"))
+	if err != nil {
+		t.Fatalf("expected report.txt in the target, got %v", err)
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("expected modification time %v, got %v", modTime, info.ModTime())
+	}
+
+	// Reproducible archives clamp the recorded time to the epoch
+	opts := format.Options{Reproducible: true, Epoch: time.Unix(1000, 0)}
+	if err := GzipFile(context.Background(), sourceFile, gzipFile, opts); err != nil {
+		t.Fatalf("GzipFile() error = %v", err)
+	}
+	os.Remove(sourceFile)
+	if err := GunzipFile(context.Background(), gzipFile, "", format.Options{}); err != nil {
+		t.Fatalf("GunzipFile() error = %v", err)
+	}
+	info, err = os.Stat(sourceFile)
+	if err != nil {
+		t.Fatalf("expected report.txt next to the source, got %v", err)
+	}
+	if !info.ModTime().Equal(opts.Epoch) {
+		t.Errorf("expected modification time %v, got %v", opts.Epoch, info.ModTime())
+	}
+}
+
+func TestGunzipFileNewer(t *testing.T) {
+	dir := t.TempDir()
+	sourceFile := filepath.Join(dir, "report.txt")
+	ioutil.WriteFile(sourceFile, []byte("new"), 0644)
+	modTime := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	os.Chtimes(sourceFile, modTime, modTime)
+
+	// The compressed file itself is written now, after the target
+	gzipFile := filepath.Join(dir, "report.txt.gz")
+	if err := GzipFile(context.Background(), sourceFile, gzipFile, format.Options{}); err != nil {
+		t.Fatalf("GzipFile() error = %v", err)
+	}
+
+	target := filepath.Join(dir, "out.txt")
+	opts := format.Options{Conflict: format.ConflictNewer}
+	ioutil.WriteFile(target, []byte("old"), 0644)
+	later := modTime.Add(time.Hour)
+	os.Chtimes(target, later, later)
+	if err := GunzipFile(context.Background(), gzipFile, target, opts); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if content, _ := ioutil.ReadFile(target); string(content) != "old" {
+		t.Errorf("expected a target newer than the header to be kept, got %q", content)
+	}
+
+	earlier := modTime.Add(-time.Hour)
+	os.Chtimes(target, earlier, earlier)
+	if err := GunzipFile(context.Background(), gzipFile, target, opts); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if content, _ := ioutil.ReadFile(target); string(content) != "new" {
+		t.Errorf("expected a target older than the header to be replaced, got %q", content)
+	}
+}
+
+func TestGunzipFileNameFromExtension(t *testing.T) {
+	dir := t.TempDir()
+	gzipFile := filepath.Join(dir, "data.json.gz")
+	file, _ := os.Create(gzipFile)
+	writer := gzip.NewWriter(file)
+	writer.Write([]byte("{}"))
+	writer.Close()
+	file.Close()
+
+	if err := GunzipFile(context.Background(), gzipFile, "", format.Options{}); err != nil {
+		t.Fatalf("GunzipFile() error = %v", err)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "data.json"))
+	if err != nil || string(content) != "{}" {
+		t.Errorf("expected data.json, got %q, %v", content, err)
+	}
+}
@@ -0,0 +1,6 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+// Package testutil holds helpers shared by the tests of several formats.
+package testutil
@@ -0,0 +1,31 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+//go:build !windows
+
+package testutil
+
+import (
+	"syscall"
+	"testing"
+)
+
+// LowerFileLimit lowers the soft RLIMIT_NOFILE of the test process to
+// limit for the rest of the test. The test is skipped if the limit cannot
+// be changed.
+func LowerFileLimit(t testing.TB, limit uint64) {
+	t.Helper()
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		t.Skipf("unable to read RLIMIT_NOFILE: %v", err)
+	}
+	lowered := rlimit
+	lowered.Cur = limit
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &lowered); err != nil {
+		t.Skipf("unable to lower RLIMIT_NOFILE: %v", err)
+	}
+	t.Cleanup(func() {
+		syscall.Setrlimit(syscall.RLIMIT_NOFILE, &rlimit)
+	})
+}
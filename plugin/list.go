@@ -0,0 +1,124 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/harness-community/drone-archive/plugin/format"
+)
+
+// listEntry is the JSON and CSV representation of an archive entry.
+type listEntry struct {
+	Name           string   `json:"name"`
+	Type           string   `json:"type"`
+	Linkname       string   `json:"linkname,omitempty"`
+	Size           int64    `json:"size"`
+	CompressedSize *int64   `json:"compressed_size,omitempty"`
+	Ratio          *float64 `json:"ratio,omitempty"`
+	Mode           string   `json:"mode"`
+	ModTime        string   `json:"mtime"`
+}
+
+func newListEntry(e format.Entry) listEntry {
+	entry := listEntry{
+		Name:     e.Name,
+		Type:     e.Type,
+		Linkname: e.Linkname,
+		Size:     e.Size,
+		Mode:     e.Mode.String(),
+		ModTime:  e.ModTime.UTC().Format(time.RFC3339),
+	}
+	if e.CompressedSize >= 0 {
+		compressed := e.CompressedSize
+		entry.CompressedSize = &compressed
+	}
+	if ratio, ok := e.Ratio(); ok {
+		entry.Ratio = &ratio
+	}
+	return entry
+}
+
+// writeEntries prints the entries to w as a table, JSON or CSV.
+func writeEntries(w io.Writer, entries []format.Entry, output string) error {
+	switch output {
+	case "", "table":
+		return writeTable(w, entries)
+	case "json":
+		list := make([]listEntry, 0, len(entries))
+		for _, e := range entries {
+			list = append(list, newListEntry(e))
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(list)
+	case "csv":
+		return writeCSV(w, entries)
+	default:
+		return fmt.Errorf("unsupported list format: %s", output)
+	}
+}
+
+func writeTable(w io.Writer, entries []format.Entry) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "MODE\tTYPE\tSIZE\tCOMPRESSED\tRATIO\tMODIFIED\tNAME")
+	for _, e := range entries {
+		entry := newListEntry(e)
+		name := entry.Name
+		if entry.Linkname != "" {
+			name += " -> " + entry.Linkname
+		}
+		fmt.Fprintf(table, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
+			entry.Mode, entry.Type, entry.Size, compressedString(entry), ratioString(entry), entry.ModTime, name)
+	}
+	return table.Flush()
+}
+
+func writeCSV(w io.Writer, entries []format.Entry) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"name", "type", "linkname", "size", "compressed_size", "ratio", "mode", "mtime"})
+	for _, e := range entries {
+		entry := newListEntry(e)
+		compressed, ratio := compressedString(entry), ratioString(entry)
+		if compressed == "-" {
+			compressed = ""
+		}
+		if ratio == "-" {
+			ratio = ""
+		}
+		writer.Write([]string{
+			entry.Name,
+			entry.Type,
+			entry.Linkname,
+			strconv.FormatInt(entry.Size, 10),
+			compressed,
+			ratio,
+			entry.Mode,
+			entry.ModTime,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func compressedString(entry listEntry) string {
+	if entry.CompressedSize == nil {
+		return "-"
+	}
+	return strconv.FormatInt(*entry.CompressedSize, 10)
+}
+
+func ratioString(entry listEntry) string {
+	if entry.Ratio == nil {
+		return "-"
+	}
+	return strconv.FormatFloat(*entry.Ratio*100, 'f', 1, 64) + "%"
+}
@@ -0,0 +1,90 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harness-community/drone-archive/plugin/format"
+)
+
+var testEntries = []format.Entry{
+	{
+		Name:           "bin/tool",
+		Type:           format.TypeFile,
+		Size:           200,
+		CompressedSize: 50,
+		Mode:           0755,
+		ModTime:        time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	},
+	{
+		Name:           "bin/link",
+		Type:           format.TypeSymlink,
+		Linkname:       "tool",
+		CompressedSize: -1,
+		Mode:           0777,
+		ModTime:        time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	},
+}
+
+func TestWriteEntriesTable(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeEntries(&buf, testEntries, "table"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header and 2 rows, got %q", buf.String())
+	}
+	if !strings.Contains(lines[1], "75.0%") || !strings.Contains(lines[1], "bin/tool") {
+		t.Errorf("expected ratio and name in row, got %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "bin/link -> tool") {
+		t.Errorf("expected symlink target in row, got %q", lines[2])
+	}
+}
+
+func TestWriteEntriesJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeEntries(&buf, testEntries, "json"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("expected valid JSON, got %v", err)
+	}
+	if len(decoded) != 2 || decoded[0]["name"] != "bin/tool" || decoded[0]["ratio"] != 0.75 {
+		t.Errorf("unexpected JSON output %s", buf.String())
+	}
+	if _, ok := decoded[1]["compressed_size"]; ok {
+		t.Errorf("expected unknown compressed size to be omitted")
+	}
+}
+
+func TestWriteEntriesCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeEntries(&buf, testEntries, "csv"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := "name,type,linkname,size,compressed_size,ratio,mode,mtime\n" +
+		"bin/tool,file,,200,50,75.0%,-rwxr-xr-x,2024-01-02T03:04:05Z\n" +
+		"bin/link,symlink,tool,0,,,-rwxrwxrwx,2024-01-02T03:04:05Z\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestWriteEntriesUnknownFormat(t *testing.T) {
+	if err := writeEntries(&bytes.Buffer{}, testEntries, "xml"); err == nil {
+		t.Errorf("expected an error for an unknown list format")
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package match
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// Ignore holds the rules of gitignore style files. Rules added later take
+// precedence, so the rules of nested files, added as the walk reaches
+// them, override those of their parents.
+type Ignore struct {
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	base     string // directory of the ignore file, relative to the source
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// Add reads the rules in r. They apply to the files below base, a slash
+// separated directory relative to the source, empty for its root.
+func (ig *Ignore) Add(base string, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(base, scanner.Text()); ok {
+			ig.rules = append(ig.rules, rule)
+		}
+	}
+	return scanner.Err()
+}
+
+// AddFile reads the rules of the ignore file at path, see Add.
+func (ig *Ignore) AddFile(base, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return ig.Add(base, file)
+}
+
+// Ignored reports whether name, a slash separated path relative to the
+// source, is ignored. The last rule that matches decides, a negated
+// rule re-includes what earlier rules ignored.
+func (ig *Ignore) Ignored(name string, dir bool) bool {
+	ignored := false
+	for _, rule := range ig.rules {
+		if rule.dirOnly && !dir {
+			continue
+		}
+
+		rel := name
+		if rule.base != "" {
+			if !strings.HasPrefix(name, rule.base+"/") {
+				continue
+			}
+			rel = name[len(rule.base)+1:]
+		}
+
+		// Rules without a slash match the name at any depth
+		if !rule.anchored {
+			rel = path.Base(rel)
+		}
+
+		if matches, _ := doublestar.Match(rule.pattern, rel); matches {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+func parseIgnoreRule(base, line string) (ignoreRule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+
+	// Trailing spaces are ignored unless escaped
+	if !strings.HasSuffix(line, `\ `) {
+		line = strings.TrimRight(line, " ")
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{base: base}
+	switch {
+	case strings.HasPrefix(line, "!"):
+		rule.negate = true
+		line = line[1:]
+	case strings.HasPrefix(line, `\!`), strings.HasPrefix(line, `\#`):
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	// A slash at the beginning or in the middle anchors the pattern to
+	// the directory of the ignore file
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	rule.pattern = line
+	return rule, true
+}
@@ -0,0 +1,58 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package match
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIgnored(t *testing.T) {
+	var ignore Ignore
+	root := `
+# build output
+*.log
+!keep.log
+build/
+/coverage.out
+docs/*.tmp
+\#notes
+`
+	if err := ignore.Add("", strings.NewReader(root)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := ignore.Add("web", strings.NewReader("dist\n!keep.log\n*.map\n")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		dir      bool
+		expected bool
+	}{
+		{"app.log", false, true},
+		{"logs/app.log", false, true},
+		{"keep.log", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"src/build", true, true},
+		{"coverage.out", false, true},
+		{"src/coverage.out", false, false},
+		{"docs/a.tmp", false, true},
+		{"docs/api/a.tmp", false, false},
+		{"#notes", false, true},
+		{"web/dist", true, true},
+		{"dist", true, false},
+		{"web/app.js.map", false, true},
+		{"app.js.map", false, false},
+		{"web/keep.log", false, false},
+	}
+
+	for _, test := range tests {
+		if actual := ignore.Ignored(test.name, test.dir); actual != test.expected {
+			t.Errorf("Ignored(%q, %v) = %v, expected %v", test.name, test.dir, actual, test.expected)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package match
+
+import (
+	"path"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// Any reports whether name, a slash separated path relative to the source
+// or inside the archive, matches at least one of the Ant style patterns.
+// A pattern without a slash also matches the base name at any depth, and
+// a pattern ending in a slash is read as dir/**.
+func Any(patterns []string, name string) bool {
+	name = strings.TrimSuffix(name, "/")
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/") {
+			pattern += "**"
+		}
+		if matches, _ := doublestar.Match(pattern, name); matches {
+			return true
+		}
+		if !strings.Contains(pattern, "/") {
+			if matches, _ := doublestar.Match(pattern, path.Base(name)); matches {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Selected reports whether name matches one of the glob patterns, or
+// there are none, and none of the exclude patterns.
+func Selected(name string, globs, excludes []string) bool {
+	if len(globs) > 0 && !Any(globs, name) {
+		return false
+	}
+	return !Any(excludes, name)
+}
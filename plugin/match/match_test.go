@@ -0,0 +1,56 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package match
+
+import "testing"
+
+func TestSelected(t *testing.T) {
+	tests := []struct {
+		name     string
+		globs    []string
+		excludes []string
+		expected bool
+	}{
+		{"file.txt", nil, nil, true},
+		{"file.txt", []string{"*.log", "*.txt"}, nil, true},
+		{"file.txt", []string{"*.log"}, nil, false},
+		{"file.txt", nil, []string{"*.log", "*.txt"}, false},
+		{"file.txt", []string{"*.txt"}, []string{"file.*"}, false},
+		{"dir/file.txt", []string{"dir/**"}, []string{"*.log"}, true},
+	}
+
+	for _, test := range tests {
+		if actual := Selected(test.name, test.globs, test.excludes); actual != test.expected {
+			t.Errorf("Selected(%q, %v, %v) = %v, expected %v", test.name, test.globs, test.excludes, actual, test.expected)
+		}
+	}
+}
+
+func TestAny(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{"*.log", "app.log", true},
+		{"*.log", "logs/nested/app.log", true},
+		{"logs/*.log", "app.log", false},
+		{"logs/*.log", "logs/nested/app.log", false},
+		{"logs/**/*.log", "logs/nested/app.log", true},
+		{"node_modules/**", "node_modules", true},
+		{"node_modules/**", "node_modules/pkg/index.js", true},
+		{"node_modules/**", "web/node_modules", false},
+		{"**/node_modules/**", "web/node_modules", true},
+		{"build/", "build/out/app", true},
+		{"build/", "build/", true},
+		{"file?.txt", "file10.txt", false},
+	}
+
+	for _, test := range tests {
+		if actual := Any([]string{test.pattern}, test.name); actual != test.expected {
+			t.Errorf("Any(%q, %q) = %v, expected %v", test.pattern, test.name, actual, test.expected)
+		}
+	}
+}
@@ -7,70 +7,296 @@ package plugin
 import (
 	"context"
 	"fmt"
-	"github.com/harness-community/drone-archive/plugin/gzip"
-	"github.com/harness-community/drone-archive/plugin/tar"
-	"github.com/harness-community/drone-archive/plugin/zip"
+	"github.com/harness-community/drone-archive/plugin/checksum"
+	"github.com/harness-community/drone-archive/plugin/format"
+	"github.com/harness-community/drone-archive/plugin/fsutil"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Plugin struct {
-	Source      string `envconfig:"PLUGIN_SOURCE"`
-	Target      string `envconfig:"PLUGIN_TARGET"`
-	Format      string `envconfig:"PLUGIN_FORMAT"`
-	Action      string `envconfig:"PLUGIN_ACTION"` // "archive" or "extract"
-	Overwrite   bool   `envconfig:"PLUGIN_OVERWRITE"`
-	TarCompress bool   `envconfig:"PLUGIN_TARCOMPRESS"`
-	Exclude     string `envconfig:"PLUGIN_EXCLUDE"`
-	Glob        string `envconfig:"PLUGIN_GLOB"`
-	LogLevel    string `envconfig:"PLUGIN_LOG_LEVEL"`
+	Source               string        `envconfig:"PLUGIN_SOURCE"` // comma or newline separated, each "path" or "path=prefix"
+	Target               string        `envconfig:"PLUGIN_TARGET"`
+	Format               string        `envconfig:"PLUGIN_FORMAT"`
+	Action               string        `envconfig:"PLUGIN_ACTION"`    // "archive", "extract", "list" or "test"
+	Overwrite            bool          `envconfig:"PLUGIN_OVERWRITE"` // same as conflict "overwrite" when conflict is unset
+	Conflict             string        `envconfig:"PLUGIN_CONFLICT"`  // "fail", "overwrite", "skip", "newer" or "rename"
+	TarCompress          bool          `envconfig:"PLUGIN_TARCOMPRESS"`
+	Compression          string        `envconfig:"PLUGIN_COMPRESSION"` // "gzip", "zstd", "xz" or "bzip2", used by tar
+	CompressionLevel     int           `envconfig:"PLUGIN_COMPRESSION_LEVEL"`
+	ZstdLong             bool          `envconfig:"PLUGIN_ZSTD_LONG"`
+	CompressionWorkers   int           `envconfig:"PLUGIN_COMPRESSION_WORKERS"`    // parallel gzip, 0 or 1 use a single core
+	CompressionBlockSize int           `envconfig:"PLUGIN_COMPRESSION_BLOCK_SIZE"` // bytes per parallel gzip block
+	FollowSymlinks       bool          `envconfig:"PLUGIN_FOLLOW_SYMLINKS"`
+	PreservePerms        bool          `envconfig:"PLUGIN_PRESERVE_PERMISSIONS" default:"true"`
+	PreserveTimes        bool          `envconfig:"PLUGIN_PRESERVE_TIMES"`
+	PreserveOwner        bool          `envconfig:"PLUGIN_PRESERVE_OWNER"`
+	Reproducible         bool          `envconfig:"PLUGIN_REPRODUCIBLE"`
+	SourceDateEpoch      string        `envconfig:"SOURCE_DATE_EPOCH"`
+	Checksums            []string      `envconfig:"PLUGIN_CHECKSUMS"`       // "sha256" and/or "sha512"
+	ChecksumOutput       string        `envconfig:"PLUGIN_CHECKSUM_OUTPUT"` // "sidecar" or "sums"
+	Checksum             string        `envconfig:"PLUGIN_CHECKSUM"`        // expected source checksum, e.g. "sha256:<hex>"
+	ChecksumFile         string        `envconfig:"PLUGIN_CHECKSUM_FILE"`
+	Exclude              string        `envconfig:"PLUGIN_EXCLUDE"`     // comma or newline separated
+	Glob                 string        `envconfig:"PLUGIN_GLOB"`        // comma or newline separated
+	IgnoreFile           string        `envconfig:"PLUGIN_IGNORE_FILE"` // gitignore style file applied to every source
+	AutoIgnore           bool          `envconfig:"PLUGIN_AUTO_IGNORE"` // honor .gitignore and .archiveignore files in the sources
+	StripComponents      int           `envconfig:"PLUGIN_STRIP_COMPONENTS"`
+	Prefix               string        `envconfig:"PLUGIN_PREFIX"` // leading directory added to entry names
+	Flatten              bool          `envconfig:"PLUGIN_FLATTEN"`
+	FlattenCollision     string        `envconfig:"PLUGIN_FLATTEN_COLLISION"` // "fail", "rename" or "overwrite"
+	ListFormat           string        `envconfig:"PLUGIN_LIST_FORMAT"`       // "table", "json" or "csv"
+	MaxTotalSize         int64         `envconfig:"PLUGIN_MAX_TOTAL_SIZE"`    // extraction limits, no limit if zero
+	MaxFileSize          int64         `envconfig:"PLUGIN_MAX_FILE_SIZE"`
+	MaxEntries           int           `envconfig:"PLUGIN_MAX_ENTRIES"`
+	MaxRatio             float64       `envconfig:"PLUGIN_MAX_RATIO"`
+	MaxDepth             int           `envconfig:"PLUGIN_MAX_DEPTH"`
+	Timeout              time.Duration `envconfig:"PLUGIN_TIMEOUT"` // e.g. "10m", no limit if zero
+	LogLevel             string        `envconfig:"PLUGIN_LOG_LEVEL"`
 }
 
 func (p *Plugin) Exec(ctx context.Context) error {
-	if !p.Overwrite {
-		if _, err := os.Stat(p.Target); err == nil {
-			return fmt.Errorf("target file or directory already exists: %s", p.Target)
+	action := strings.ToLower(p.Action)
+
+	// Only archiving combines several sources, each with an optional
+	// =prefix. The other actions read a single archive, whose name may
+	// contain commas or an equals sign.
+	var sources []format.Source
+	if action == "archive" {
+		for _, source := range splitList(p.Source) {
+			sources = append(sources, format.ParseSource(source))
+		}
+	} else if source := strings.TrimSpace(p.Source); source != "" {
+		sources = append(sources, format.Source{Path: source})
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("no source given")
+	}
+	source := sources[0].Path
+
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	name := strings.ToLower(p.Format)
+	if name == format.Auto {
+		if action == "archive" {
+			return fmt.Errorf("format %s is not supported for archive", format.Auto)
+		}
+		detected, err := format.Detect(source)
+		if err != nil {
+			return err
 		}
+		name = detected
+	}
+
+	f, ok := format.Lookup(name)
+	if !ok {
+		return fmt.Errorf("unsupported format: %s, expected one of %s", p.Format, strings.Join(format.Names(), ", "))
 	}
 
-	switch strings.ToLower(p.Format) {
-	case "zip":
-		return p.handleZip()
-	case "tar":
-		return p.handleTar()
-	case "gzip":
-		return p.handleGzip()
+	opts := format.Options{
+		Globs:      splitList(p.Glob),
+		Excludes:   splitList(p.Exclude),
+		IgnoreFile: p.IgnoreFile,
+
+		Conflict: strings.ToLower(p.Conflict),
+		Limits: format.Limits{
+			MaxTotalSize: p.MaxTotalSize,
+			MaxFileSize:  p.MaxFileSize,
+			MaxEntries:   p.MaxEntries,
+			MaxRatio:     p.MaxRatio,
+			MaxDepth:     p.MaxDepth,
+		},
+
+		StripComponents: p.StripComponents,
+		Prefix:          p.Prefix,
+
+		Flatten:          p.Flatten,
+		FlattenCollision: strings.ToLower(p.FlattenCollision),
+
+		Compression: strings.ToLower(p.Compression),
+		Level:       p.CompressionLevel,
+		Long:        p.ZstdLong,
+		Workers:     p.CompressionWorkers,
+		BlockSize:   p.CompressionBlockSize,
+
+		FollowSymlinks: p.FollowSymlinks,
+		Preserve: fsutil.Preserve{
+			Permissions: p.PreservePerms,
+			Times:       p.PreserveTimes,
+			Owner:       p.PreserveOwner,
+		},
+		Reproducible: p.Reproducible,
+		Epoch:        fsutil.DefaultEpoch,
+
+		Checksums:      p.Checksums,
+		ChecksumOutput: strings.ToLower(p.ChecksumOutput),
+	}
+	if p.SourceDateEpoch != "" {
+		seconds, err := strconv.ParseInt(p.SourceDateEpoch, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid SOURCE_DATE_EPOCH: %s", p.SourceDateEpoch)
+		}
+		opts.Epoch = time.Unix(seconds, 0).UTC()
+	}
+	// overwrite predates the conflict setting
+	switch opts.Conflict {
+	case "":
+		opts.Conflict = format.ConflictFail
+		if p.Overwrite {
+			opts.Conflict = format.ConflictOverwrite
+		}
+	case format.ConflictFail, format.ConflictOverwrite, format.ConflictSkip, format.ConflictNewer, format.ConflictRename:
+	default:
+		return fmt.Errorf("unsupported conflict policy: %s", p.Conflict)
+	}
+	// Checked up front, an archive is written before its checksums
+	switch opts.ChecksumOutput {
+	case "", checksum.Sidecar, checksum.Sums:
 	default:
-		return fmt.Errorf("unsupported format: %s", p.Format)
+		return fmt.Errorf("unsupported checksum output: %s", p.ChecksumOutput)
+	}
+	if p.StripComponents < 0 {
+		return fmt.Errorf("invalid strip components: %d", p.StripComponents)
+	}
+	if p.AutoIgnore {
+		opts.IgnoreNames = []string{".gitignore", ".archiveignore"}
+	}
+	// tarcompress predates the compression setting and means gzip.
+	if opts.Compression == "" && p.TarCompress {
+		opts.Compression = "gzip"
+	}
+
+	switch action {
+	case "archive":
+		// Formats compressing each file on its own resolve conflicts for
+		// every file they write
+		if batch, ok := f.(format.BatchFormat); ok && batch.Batch(sources) {
+			return f.Archive(ctx, sources, p.Target, opts)
+		}
+		if p.Target == "" {
+			return fmt.Errorf("no target given")
+		}
+		target, err := archiveTarget(ctx, p.Target, sources, opts)
+		if err != nil || target == "" {
+			return err
+		}
+		return f.Archive(ctx, sources, target, opts)
+	case "extract":
+		if err := p.verifySource(ctx, source); err != nil {
+			return err
+		}
+		_, statErr := os.Stat(p.Target)
+		err := f.Extract(ctx, source, p.Target, opts)
+		if format.Aborted(ctx, err) && p.Target != "" && os.IsNotExist(statErr) {
+			// Remove the partial target, unless it existed before and
+			// holds files that were not extracted
+			os.RemoveAll(p.Target)
+		}
+		return err
+	case "list":
+		entries, err := f.List(ctx, source, opts)
+		if err != nil {
+			return err
+		}
+		return writeEntries(os.Stdout, entries, strings.ToLower(p.ListFormat))
+	case "test":
+		if err := p.verifySource(ctx, source); err != nil {
+			return err
+		}
+		if err := f.Test(ctx, source, opts); err != nil {
+			return err
+		}
+		fmt.Printf("%s: OK\n", source)
+		return nil
+	default:
+		return fmt.Errorf("unsupported action for %s: %s", p.Format, p.Action)
 	}
 }
 
-func (p *Plugin) handleZip() error {
-	if strings.ToLower(p.Action) == "archive" {
-		return zip.Zip(p.Source, p.Target, p.Exclude, p.Glob)
-	} else if strings.ToLower(p.Action) == "extract" {
-		return zip.Unzip(p.Source, p.Target, p.Glob)
-	} else {
-		return fmt.Errorf("unsupported action for zip: %s", p.Action)
+// verifySource checks the source archive against the expected checksum,
+// if one is configured, before anything is extracted from it.
+func (p *Plugin) verifySource(ctx context.Context, source string) error {
+	var expected checksum.Expected
+	var err error
+
+	switch {
+	case p.Checksum != "":
+		expected, err = checksum.Parse(p.Checksum)
+	case p.ChecksumFile != "":
+		expected, err = checksum.FromFile(p.ChecksumFile, filepath.Base(source))
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
 	}
+
+	return checksum.Verify(ctx, source, expected)
 }
 
-func (p *Plugin) handleTar() error {
-	if strings.ToLower(p.Action) == "archive" {
-		return tar.Tar(p.Source, p.Target, p.Exclude, p.Glob, p.TarCompress)
-	} else if strings.ToLower(p.Action) == "extract" {
-		return tar.Untar(p.Source, p.Target, p.Glob)
-	} else {
-		return fmt.Errorf("unsupported action for tar: %s", p.Action)
+// archiveTarget applies the conflict policy to the archive about to be
+// created at target. It returns an empty target if the archive is not to
+// be created.
+func archiveTarget(ctx context.Context, target string, sources []format.Source, opts format.Options) (string, error) {
+	// An archive is newer than an existing one if any of its files is
+	var modTime time.Time
+	if opts.Conflict == format.ConflictNewer {
+		for _, source := range sources {
+			err := filepath.Walk(source.Path, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if info.ModTime().After(modTime) {
+					modTime = info.ModTime()
+				}
+				return nil
+			})
+			if err != nil {
+				return "", err
+			}
+		}
 	}
+
+	resolved, err := opts.ResolveConflict(target, modTime)
+	if err == nil && resolved == "" {
+		fmt.Printf("Skipping existing target: %s\n", target)
+	}
+	return resolved, err
 }
 
-func (p *Plugin) handleGzip() error {
-	if strings.ToLower(p.Action) == "archive" {
-		return gzip.GzipFile(p.Source, p.Target)
-	} else if strings.ToLower(p.Action) == "extract" {
-		return gzip.GunzipFile(p.Source, p.Target)
-	} else {
-		return fmt.Errorf("unsupported action for gzip: %s", p.Action)
+// splitList splits a comma or newline separated setting into its
+// non-empty, trimmed values. Commas inside braces separate the
+// alternatives of a pattern like *.{html,css} and do not split.
+func splitList(s string) []string {
+	var values []string
+	add := func(value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	depth, start := 0, 0
+	for i, r := range s {
+		switch {
+		case r == '{':
+			depth++
+		case r == '}' && depth > 0:
+			depth--
+		case r == '\n' || (r == ',' && depth == 0):
+			add(s[start:i])
+			depth, start = 0, i+1
+		}
 	}
+	add(s[start:])
+	return values
 }
@@ -0,0 +1,280 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harness-community/drone-archive/plugin/checksum"
+)
+
+func TestExecVerifiesChecksum(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(sourceDir, 0755)
+	os.WriteFile(filepath.Join(sourceDir, "file.txt"), []byte("content"), 0644)
+
+	archive := filepath.Join(dir, "archive.tar")
+	err := (&Plugin{Source: sourceDir, Target: archive, Format: "tar", Action: "archive"}).Exec(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	content, _ := os.ReadFile(archive)
+	sum := sha256.Sum256(content)
+	good := "sha256:" + hex.EncodeToString(sum[:])
+	bad := "sha256:" + hex.EncodeToString(make([]byte, sha256.Size))
+
+	extractDir := filepath.Join(dir, "bad")
+	err = (&Plugin{Source: archive, Target: extractDir, Format: "tar", Action: "extract", Checksum: bad}).Exec(context.Background())
+	var mismatch *checksum.MismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected MismatchError, got %v", err)
+	}
+	if _, err := os.Stat(extractDir); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be extracted on a mismatch")
+	}
+
+	extractDir = filepath.Join(dir, "good")
+	err = (&Plugin{Source: archive, Target: extractDir, Format: "tar", Action: "extract", Checksum: good}).Exec(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	sums := filepath.Join(dir, "SHA256SUMS")
+	os.WriteFile(sums, []byte(hex.EncodeToString(sum[:])+"  archive.tar\n"), 0644)
+	err = (&Plugin{Source: archive, Format: "tar", Action: "test", ChecksumFile: sums}).Exec(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	actual := splitList("dist=bundle/bin, docs\nREADME.md,\n")
+	expected := []string{"dist=bundle/bin", "docs", "README.md"}
+	if strings.Join(actual, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	actual = splitList("**/*.{html,css,js,svg}, vendor/{a,b}/**")
+	expected = []string{"**/*.{html,css,js,svg}", "vendor/{a,b}/**"}
+	if strings.Join(actual, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestExecCancelledRemovesTarget(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(sourceDir, 0755)
+	os.WriteFile(filepath.Join(sourceDir, "file.txt"), []byte("content"), 0644)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	archive := filepath.Join(dir, "archive.tar")
+	err := (&Plugin{Source: sourceDir, Target: archive, Format: "tar", Action: "archive"}).Exec(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if _, err := os.Stat(archive); !os.IsNotExist(err) {
+		t.Errorf("expected the partial archive to be removed, got %v", err)
+	}
+
+	err = (&Plugin{Source: sourceDir, Target: archive, Format: "tar", Action: "archive", Timeout: time.Nanosecond}).Exec(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+// cancelAfter is a context cancelled once Err has been called n times,
+// which cancels an extraction part way through.
+type cancelAfter struct {
+	context.Context
+	n int
+}
+
+func (c *cancelAfter) Err() error {
+	if c.n <= 0 {
+		return context.Canceled
+	}
+	c.n--
+	return nil
+}
+
+func TestExecCancelledExtract(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(filepath.Join(sourceDir, "nested"), 0755)
+	for i := 0; i < 5; i++ {
+		os.WriteFile(filepath.Join(sourceDir, "nested", fmt.Sprintf("file%d.txt", i)), []byte("content"), 0644)
+	}
+
+	for _, name := range []string{"tar", "zip"} {
+		archive := filepath.Join(dir, "archive."+name)
+		err := (&Plugin{Source: sourceDir, Target: archive, Format: name, Action: "archive"}).Exec(context.Background())
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		// A target created by the extraction is removed
+		target := filepath.Join(dir, "new-"+name)
+		err = (&Plugin{Source: archive, Target: target, Format: name, Action: "extract"}).Exec(&cancelAfter{context.Background(), 8})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("%s: expected context.Canceled, got %v", name, err)
+		}
+		if _, err := os.Stat(target); !os.IsNotExist(err) {
+			t.Errorf("%s: expected the partial target to be removed, got %v", name, err)
+		}
+
+		// An existing target keeps the files it held before
+		target = filepath.Join(dir, "existing-"+name)
+		os.MkdirAll(filepath.Join(target, "nested"), 0755)
+		os.WriteFile(filepath.Join(target, "keep.txt"), []byte("keep"), 0644)
+		os.WriteFile(filepath.Join(target, "nested", "keep.txt"), []byte("keep"), 0644)
+		err = (&Plugin{Source: archive, Target: target, Format: name, Action: "extract"}).Exec(&cancelAfter{context.Background(), 8})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("%s: expected context.Canceled, got %v", name, err)
+		}
+		for _, kept := range []string{"keep.txt", filepath.Join("nested", "keep.txt")} {
+			if content, err := os.ReadFile(filepath.Join(target, kept)); err != nil || string(content) != "keep" {
+				t.Errorf("%s: expected %s to survive, got %q, %v", name, kept, content, err)
+			}
+		}
+		var paths []string
+		filepath.Walk(target, func(path string, info os.FileInfo, err error) error {
+			rel, _ := filepath.Rel(target, path)
+			paths = append(paths, filepath.ToSlash(rel))
+			return nil
+		})
+		if strings.Join(paths, ",") != ".,keep.txt,nested,nested/keep.txt" {
+			t.Errorf("%s: expected only the existing files, got %v", name, paths)
+		}
+	}
+}
+
+func TestExecArchiveConflict(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(sourceDir, 0755)
+	os.WriteFile(filepath.Join(sourceDir, "file.txt"), []byte("content"), 0644)
+	archive := filepath.Join(dir, "archive.tar")
+	os.WriteFile(archive, []byte("existing"), 0644)
+
+	err := (&Plugin{Source: sourceDir, Target: archive, Format: "tar", Action: "archive"}).Exec(context.Background())
+	if err == nil {
+		t.Fatalf("expected an existing archive to fail by default")
+	}
+
+	err = (&Plugin{Source: sourceDir, Target: archive, Format: "tar", Action: "archive", Conflict: "skip"}).Exec(context.Background())
+	if content, _ := os.ReadFile(archive); err != nil || string(content) != "existing" {
+		t.Errorf("expected the existing archive to be kept, got %q, %v", content, err)
+	}
+
+	err = (&Plugin{Source: sourceDir, Target: archive, Format: "tar", Action: "archive", Conflict: "rename"}).Exec(context.Background())
+	if _, statErr := os.Stat(filepath.Join(dir, "archive-1.tar")); err != nil || statErr != nil {
+		t.Errorf("expected archive-1.tar to be created, got %v, %v", err, statErr)
+	}
+}
+
+func TestExecArchiveRequiresTarget(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "file.txt")
+	os.WriteFile(source, []byte("content"), 0644)
+
+	for _, name := range []string{"zip", "tar", "gzip", "zstd"} {
+		err := (&Plugin{Source: source, Format: name, Action: "archive"}).Exec(context.Background())
+		if err == nil {
+			t.Errorf("expected %s without a target to fail", name)
+		}
+	}
+}
+
+func TestExecGzipBraceGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"index.html", "a.css", "sub/b.js", "logo.png"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("content"), 0644)
+	}
+
+	p := &Plugin{Source: dir, Format: "gzip", Action: "archive", Glob: "**/*.{html,css,js,svg}"}
+	if err := p.Exec(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, name := range []string{"index.html.gz", "a.css.gz", "sub/b.js.gz"} {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			t.Errorf("expected %s, got %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "logo.png.gz")); !os.IsNotExist(err) {
+		t.Errorf("expected logo.png to be left out, got %v", err)
+	}
+
+	// Nothing left to select fails rather than silently succeeding
+	p.Glob = "**/*.txt"
+	if err := p.Exec(context.Background()); err == nil {
+		t.Errorf("expected an error when no files are selected")
+	}
+}
+
+func TestExecInvalidChecksumOutput(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "file.txt")
+	os.WriteFile(source, []byte("content"), 0644)
+	archive := filepath.Join(dir, "archive.zip")
+
+	p := &Plugin{Source: source, Target: archive, Format: "zip", Action: "archive", Checksums: []string{"sha256"}, ChecksumOutput: "sidecars"}
+	if err := p.Exec(context.Background()); err == nil {
+		t.Fatalf("expected an unsupported checksum output to fail")
+	}
+	if _, err := os.Stat(archive); !os.IsNotExist(err) {
+		t.Errorf("expected no archive to be written, got %v", err)
+	}
+}
+
+func TestExecUnsupportedFormat(t *testing.T) {
+	err := (&Plugin{Source: "archive.rar", Target: "out", Format: "rar", Action: "extract"}).Exec(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "bzip2, gzip, tar, xz, zip, zstd") {
+		t.Errorf("expected the error to list the registered formats, got %v", err)
+	}
+}
+
+func TestExecExtractSourceAsGiven(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(sourceDir, 0755)
+	os.WriteFile(filepath.Join(sourceDir, "file.txt"), []byte("content"), 0644)
+
+	for _, name := range []string{"build=1.tar", "a,b.tar"} {
+		archive := filepath.Join(dir, name)
+		err := (&Plugin{Source: sourceDir, Target: archive, Format: "tar", Action: "archive"}).Exec(context.Background())
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		target := filepath.Join(dir, "out-"+name)
+		err = (&Plugin{Source: " " + archive + "\n", Target: target, Format: "auto", Action: "extract"}).Exec(context.Background())
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(target, "file.txt")); err != nil {
+			t.Errorf("%s: expected file.txt to be extracted, got %v", name, err)
+		}
+		err = (&Plugin{Source: archive, Format: "tar", Action: "test"}).Exec(context.Background())
+		if err != nil {
+			t.Errorf("%s: expected no error, got %v", name, err)
+		}
+	}
+}
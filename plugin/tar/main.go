@@ -6,59 +6,174 @@ package tar
 
 import (
 	"archive/tar"
-	"compress/gzip"
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
+	"time"
 
-	"github.com/bmatcuk/doublestar/v4"
+	"github.com/harness-community/drone-archive/plugin/checksum"
+	"github.com/harness-community/drone-archive/plugin/compress"
+	"github.com/harness-community/drone-archive/plugin/format"
+	"github.com/harness-community/drone-archive/plugin/fsutil"
+	"github.com/harness-community/drone-archive/plugin/match"
 )
 
-func Tar(source, target, excludePattern, globPattern string, compress bool) error {
-	var fileWriter io.WriteCloser
-	fileWriter, err := os.Create(target)
+func init() {
+	format.Register("tar", tarFormat{})
+}
+
+type tarFormat struct{}
+
+func (tarFormat) Archive(ctx context.Context, sources []format.Source, target string, opts format.Options) error {
+	return Tar(ctx, sources, target, opts)
+}
+
+func (tarFormat) Extract(ctx context.Context, source, target string, opts format.Options) error {
+	return Untar(ctx, source, target, opts)
+}
+
+func (tarFormat) List(ctx context.Context, source string, opts format.Options) ([]format.Entry, error) {
+	return List(ctx, source, opts)
+}
+
+func (tarFormat) Test(ctx context.Context, source string, opts format.Options) error {
+	return Test(ctx, source)
+}
+
+// Tar writes the files and directories of every source to the tar file at
+// target. The contents of a directory source are stored under its prefix.
+func Tar(ctx context.Context, sources []format.Source, target string, opts format.Options) error {
+	// Write to a temporary file that replaces the target once complete
+	fileWriter, err := fsutil.CreateAtomic(target, 0644)
+	if err != nil {
+		return err
+	}
+	defer fileWriter.Cleanup()
+
+	// Checksum the archive while it is written
+	hashed, err := checksum.NewWriter(fileWriter, opts.Checksums)
 	if err != nil {
 		return err
 	}
-	defer fileWriter.Close()
 
-	var writer io.Writer = fileWriter
-	if compress {
-		writer = gzip.NewWriter(fileWriter)
-		defer writer.(*gzip.Writer).Close()
+	var writer io.Writer = hashed
+	var compressor io.WriteCloser
+	if opts.Compression != "" {
+		compressor, err = compress.NewWriter(opts.Compression, hashed, compress.Options{
+			Level:     opts.Level,
+			Long:      opts.Long,
+			Workers:   opts.Workers,
+			BlockSize: opts.BlockSize,
+		})
+		if err != nil {
+			return err
+		}
+		defer compressor.Close()
+		writer = compressor
 	}
 
 	tarWriter := tar.NewWriter(writer)
 	defer tarWriter.Close()
 
-	return filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+	// Names of files already archived, by identity, so further hardlinks
+	// to them are stored as links instead of copies
+	hardlinks := map[fsutil.FileID]string{}
+
+	namer, err := format.NewArchiveNamer(opts)
+	if err != nil {
+		return err
+	}
+
+	// The source being walked and its filter
+	var source format.Source
+	var filter *format.Filter
+
+	var walk filepath.WalkFunc
+	walk = func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-		// Apply glob and exclude patterns
-		matchesGlob, _ := doublestar.Match(globPattern, path)
-		matchesExclude, _ := doublestar.Match(excludePattern, path)
+		// Apply the glob, exclude and ignore rules to the path relative
+		// to the source
+		if selected, err := filter.Visit(source.Rel(path, info), path, info); !selected {
+			// Skip this file, err is SkipDir for an excluded directory
+			return err
+		}
 
-		if (globPattern != "" && !matchesGlob) || (excludePattern != "" && matchesExclude) {
-			// Skip this file or directory
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if opts.FollowSymlinks {
+				info, err = os.Stat(path)
+				if err != nil {
+					return fmt.Errorf("failed to follow symlink %s: %w", path, err)
+				}
+			} else if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		if info.Mode()&os.ModeSocket != 0 {
+			fmt.Printf("Skipping unsupported file type: %s\n", path)
 			return nil
 		}
 
-		header, err := tar.FileInfoHeader(info, "")
+		header, err := tar.FileInfoHeader(info, link)
 		if err != nil {
 			return err
 		}
 
-		header.Name = strings.TrimPrefix(strings.Replace(path, source, "", -1), string(filepath.Separator))
-
-		if err := tarWriter.WriteHeader(header); err != nil {
+		name, ok, err := namer.Name(source.EntryName(path, info), info.IsDir())
+		if err != nil {
 			return err
 		}
+		if !ok && !info.IsDir() {
+			// Nothing is left of the name after stripping components
+			return nil
+		}
+		header.Name = name
+
+		if opts.Reproducible {
+			header.ModTime = fsutil.ClampTime(header.ModTime, opts.Epoch)
+			header.AccessTime = time.Time{}
+			header.ChangeTime = time.Time{}
+			header.Uid, header.Gid = 0, 0
+			header.Uname, header.Gname = "", ""
+			header.Mode = int64(fsutil.NormalizeMode(info.Mode()).Perm())
+		}
 
-		if info.IsDir() {
+		if id, ok := fsutil.HardlinkID(info); ok && info.Mode().IsRegular() {
+			if first, seen := hardlinks[id]; seen {
+				header.Typeflag = tar.TypeLink
+				header.Linkname = first
+				header.Size = 0
+			} else {
+				hardlinks[id] = header.Name
+			}
+		}
+
+		// Directories left without a name, like the root of a source
+		// without prefix, have no entry but are still walked
+		if header.Name != "" {
+			if err := tarWriter.WriteHeader(header); err != nil {
+				return err
+			}
+		}
+
+		// filepath.Walk does not descend into symlinked directories, so
+		// walk a followed one explicitly through the link
+		if info.IsDir() && link == "" && isSymlink(path) {
+			return walkSymlinkDir(source.Path, path, walk)
+		}
+
+		if header.Typeflag != tar.TypeReg {
 			return nil
 		}
 
@@ -68,37 +183,117 @@ func Tar(source, target, excludePattern, globPattern string, compress bool) erro
 		}
 		defer file.Close()
 
-		_, err = io.Copy(tarWriter, file)
+		_, err = fsutil.Copy(ctx, tarWriter, file)
 		return err
+	}
+
+	for _, source = range sources {
+		if filter, err = format.NewFilter(opts); err != nil {
+			return err
+		}
+		if err := filepath.Walk(source.Path, walk); err != nil {
+			return err
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	if compressor != nil {
+		if err := compressor.Close(); err != nil {
+			return err
+		}
+	}
+	if err := fileWriter.Commit(); err != nil {
+		return err
+	}
+	return hashed.Save(target, opts.ChecksumOutput)
+}
+
+func isSymlink(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
+// walkSymlinkDir walks the directory a followed symlink points to, using
+// paths through the link so entry names stay relative to the source. The
+// link is a loop if it resolves to a directory on the walk path from the
+// source root, including those entered through other links, or above it.
+func walkSymlinkDir(source, path string, walk filepath.WalkFunc) error {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	source = filepath.Clean(source)
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		ancestor, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return err
+		}
+		if fsutil.Within(resolved, ancestor) {
+			return fmt.Errorf("symlink loop detected at %s", path)
+		}
+		if dir == source || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	root := path + string(filepath.Separator)
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		// The link itself has already been archived
+		if p == root {
+			return err
+		}
+		return walk(p, info, err)
 	})
 }
 
-func Untar(source, target, globPattern string) error {
+func Untar(ctx context.Context, source, target string, opts format.Options) (err error) {
+	// An aborted extraction removes what it created, but nothing that
+	// was there before
+	var created fsutil.Created
+	defer func() {
+		if format.Aborted(ctx, err) {
+			created.Remove()
+		}
+	}()
+
 	// Ensure the base target directory exists
-	if err := os.MkdirAll(target, 0755); err != nil {
+	if err := created.MkdirAll(target, 0755); err != nil {
 		return fmt.Errorf("failed to create target directory: %w", err)
 	}
 
-	// Open the source tar file
-	file, err := os.Open(source)
+	namer, err := format.NewNamer(opts)
 	if err != nil {
-		return fmt.Errorf("failed to open source file: %w", err)
+		return err
 	}
-	defer file.Close()
 
-	var reader io.Reader = file
-	// Handle .gz compressed files
-	if strings.HasSuffix(source, ".gz") {
-		reader, err = gzip.NewReader(file)
-		if err != nil {
-			return fmt.Errorf("failed to create gzip reader: %w", err)
-		}
-		defer reader.(*gzip.Reader).Close()
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	limiter := format.NewLimiter(opts.Limits, info.Size())
+
+	stream, closeTar, err := openTar(source)
+	if err != nil {
+		return err
 	}
+	defer closeTar()
 
-	tarReader := tar.NewReader(reader)
+	tarReader := tar.NewReader(stream)
+
+	var dirs fsutil.PendingDirs
+
+	conflicts := format.NewConflicts(opts)
+
+	// Paths of the entries on disk, the only valid hardlink targets
+	extracted := map[string]bool{}
 
 	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		header, err := tarReader.Next()
 		if err == io.EOF {
 			// End of tar archive
@@ -108,46 +303,313 @@ func Untar(source, target, globPattern string) error {
 			return fmt.Errorf("error reading tar file: %w", err)
 		}
 
-		// Match the header name with the provided glob pattern
-		matchesGlob, _ := doublestar.Match(globPattern, header.Name)
+		// Match the header name with the provided glob patterns
+		if !match.Selected(header.Name, opts.Globs, nil) {
+			// Skip this file if it doesn't match the glob patterns
+			continue
+		}
 
-		if globPattern != "" && !matchesGlob {
-			// Skip this file if it doesn't match the glob pattern
+		name, ok, err := namer.Name(header.Name, header.Typeflag == tar.TypeDir)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// Nothing is left of the name after stripping components, or
+			// a directory in flatten mode
 			continue
 		}
 
-		// Construct the full target path for the file or directory
-		targetPath := filepath.Join(target, header.Name)
+		if err := limiter.Entry(name, header.Size); err != nil {
+			return err
+		}
+
+		// Construct the full target path for the file or directory, making
+		// sure it stays within the target directory
+		targetPath, err := fsutil.SecureJoin(target, name)
+		if err != nil {
+			return err
+		}
+
+		// Existing directories are merged, existing files are handled
+		// according to the conflict policy
+		if header.Typeflag != tar.TypeDir {
+			existing := targetPath
+			targetPath, err = conflicts.Resolve(targetPath, header.ModTime)
+			if err != nil {
+				return err
+			}
+			if targetPath == "" {
+				fmt.Printf("Skipping existing file: %s\n", name)
+				extracted[existing] = true
+				continue
+			}
+		}
 
 		switch header.Typeflag {
 		case tar.TypeDir:
 			// Create the directory if it doesn't exist
-			if err := os.MkdirAll(targetPath, 0755); err != nil {
+			if err := created.MkdirAll(targetPath, 0755); err != nil {
 				return fmt.Errorf("failed to create directory %s: %w", targetPath, err)
 			}
+			dirs.Add(targetPath, metadata(header))
+			continue
 
 		case tar.TypeReg:
 			// Ensure the parent directory exists
-			if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
-				return fmt.Errorf("failed to create parent directory for %s: %w", targetPath, err)
+			if err := prepareEntry(&created, targetPath); err != nil {
+				return err
+			}
+
+			// Write the content, closing the file before the next entry
+			if err := fsutil.WriteFile(ctx, targetPath, limiter.Reader(name, tarReader), 0666); err != nil {
+				return fmt.Errorf("failed to write file %s: %w", targetPath, err)
 			}
 
-			// Create the file and copy its content
-			outFile, err := os.Create(targetPath)
+		case tar.TypeSymlink:
+			if err := prepareEntry(&created, targetPath); err != nil {
+				return err
+			}
+			if err := os.Symlink(header.Linkname, targetPath); err != nil {
+				return fmt.Errorf("failed to create symlink %s: %w", targetPath, err)
+			}
+
+		case tar.TypeLink:
+			// Hardlink targets are archive paths, renamed like the entry
+			// names, and must stay within the target directory as well
+			linkname, ok := namer.Link(header.Linkname)
+			if !ok {
+				fmt.Printf("Skipping hardlink to stripped entry: %s\n", header.Name)
+				continue
+			}
+			linkPath, err := fsutil.SecureJoin(target, linkname)
 			if err != nil {
-				return fmt.Errorf("failed to create file %s: %w", targetPath, err)
+				return err
+			}
+			linkPath = conflicts.Path(linkPath)
+			if !extracted[linkPath] {
+				// The target was left out, by a glob for example
+				fmt.Printf("Skipping hardlink to entry not extracted: %s\n", header.Name)
+				continue
+			}
+			if err := prepareEntry(&created, targetPath); err != nil {
+				return err
+			}
+			if err := os.Link(linkPath, targetPath); err != nil {
+				return fmt.Errorf("failed to create hardlink %s: %w", targetPath, err)
+			}
+			// A hardlink shares the attributes of the file it points to
+			extracted[targetPath] = true
+			continue
+
+		case tar.TypeFifo:
+			if err := prepareEntry(&created, targetPath); err != nil {
+				return err
+			}
+			if err := fsutil.Mkfifo(targetPath, header.FileInfo().Mode()); err != nil {
+				return fmt.Errorf("failed to create fifo %s: %w", targetPath, err)
 			}
-			defer outFile.Close()
 
-			if _, err := io.Copy(outFile, tarReader); err != nil {
-				return fmt.Errorf("failed to copy file content to %s: %w", targetPath, err)
+		case tar.TypeChar, tar.TypeBlock:
+			if err := prepareEntry(&created, targetPath); err != nil {
+				return err
+			}
+			if err := fsutil.Mknod(targetPath, header.FileInfo().Mode(), header.Devmajor, header.Devminor); err != nil {
+				return fmt.Errorf("failed to create device %s: %w", targetPath, err)
 			}
 
 		default:
 			// Handle other file types if necessary, or skip them
 			fmt.Printf("Skipping unsupported file type: %s\n", header.Name)
+			continue
+		}
+
+		if err := opts.Preserve.Restore(targetPath, metadata(header)); err != nil {
+			return err
+		}
+		extracted[targetPath] = true
+	}
+
+	return dirs.Restore(opts.Preserve)
+}
+
+// openTar opens the tar file at source and returns its uncompressed
+// stream. Compressed files such as .tar.gz or .tar.zst are detected from
+// their magic bytes rather than trusting the extension, and decompressed
+// on the fly.
+func openTar(source string) (io.Reader, func(), error) {
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open source file: %w", err)
+	}
+
+	buffered := bufio.NewReader(file)
+	magic, _ := buffered.Peek(6)
+
+	compression := compress.Detect(magic)
+	if compression == "" {
+		return buffered, func() { file.Close() }, nil
+	}
+
+	decompressor, err := compress.NewReader(compression, buffered)
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to create %s reader: %w", compression, err)
+	}
+	closeAll := func() {
+		decompressor.Close()
+		file.Close()
+	}
+	return decompressor, closeAll, nil
+}
+
+func metadata(header *tar.Header) fsutil.Metadata {
+	return fsutil.Metadata{
+		Mode:       header.FileInfo().Mode(),
+		ModTime:    header.ModTime,
+		AccessTime: header.AccessTime,
+		Uid:        header.Uid,
+		Gid:        header.Gid,
+	}
+}
+
+// prepareEntry creates the parent directory of path and removes any file
+// or symlink already there, so the new entry replaces it instead of
+// writing through it. Whatever it creates is recorded in created.
+func prepareEntry(created *fsutil.Created, path string) error {
+	if err := created.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create parent directory for %s: %w", path, err)
+	}
+	created.Add(path)
+	if err := fsutil.RemoveExisting(path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// List returns the entries of the tar file at source that match the glob
+// pattern.
+func List(ctx context.Context, source string, opts format.Options) ([]format.Entry, error) {
+	stream, closeTar, err := openTar(source)
+	if err != nil {
+		return nil, err
+	}
+	defer closeTar()
+
+	tarReader := tar.NewReader(stream)
+
+	var entries []format.Entry
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading tar file: %w", err)
+		}
+
+		if !match.Selected(header.Name, opts.Globs, nil) {
+			continue
+		}
+
+		entries = append(entries, format.Entry{
+			Name:           header.Name,
+			Type:           entryType(header.Typeflag),
+			Linkname:       header.Linkname,
+			Size:           header.Size,
+			CompressedSize: -1,
+			Mode:           header.FileInfo().Mode(),
+			ModTime:        header.ModTime,
+		})
+	}
+}
+
+func entryType(typeflag byte) string {
+	switch typeflag {
+	case tar.TypeReg:
+		return format.TypeFile
+	case tar.TypeDir:
+		return format.TypeDir
+	case tar.TypeSymlink:
+		return format.TypeSymlink
+	case tar.TypeLink:
+		return format.TypeHardlink
+	default:
+		return format.TypeOther
+	}
+}
+
+// Test reads every entry of the tar file at source without writing to
+// disk. A broken tar stream cannot be read past the damage, so at most one
+// corrupted entry is reported.
+func Test(ctx context.Context, source string) error {
+	stream, closeTar, err := openTar(source)
+	if err != nil {
+		return err
+	}
+	defer closeTar()
+
+	// The tar reader takes a stream that ends between two entries for a
+	// complete archive, count the bytes read to require the two zero
+	// blocks that mark its end
+	counter := &countingReader{r: stream}
+	tarReader := tar.NewReader(counter)
+	name := "(archive)"
+	var end int64
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return corrupt(ctx, source, "(entry after "+name+")", err)
+		}
+
+		name = header.Name
+		if _, err := fsutil.Copy(ctx, io.Discard, tarReader); err != nil {
+			return corrupt(ctx, source, name, err)
 		}
+		end = (counter.n + blockSize - 1) / blockSize * blockSize
+	}
+	if counter.n-end < 2*blockSize {
+		return corrupt(ctx, source, "(entry after "+name+")", errMissingEnd)
 	}
 
+	// Read up to the end of the compressed stream so its trailer, and
+	// the checksum in it, is verified as well
+	if _, err := fsutil.Copy(ctx, io.Discard, stream); err != nil {
+		return corrupt(ctx, source, "(archive)", err)
+	}
 	return nil
 }
+
+// blockSize is the size of the blocks a tar archive is made of.
+const blockSize = 512
+
+var errMissingEnd = errors.New("archive is truncated, end-of-archive marker missing")
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func corrupt(ctx context.Context, source, name string, err error) error {
+	// A cancelled test says nothing about the archive
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return &format.CorruptError{
+		Source:  source,
+		Entries: []format.CorruptEntry{{Name: name, Err: err}},
+	}
+}
@@ -5,9 +5,19 @@
 package tar
 
 import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/harness-community/drone-archive/plugin/format"
+	"github.com/harness-community/drone-archive/plugin/fsutil"
 )
 
 func TestTarArchive(t *testing.T) {
@@ -17,7 +27,7 @@ func TestTarArchive(t *testing.T) {
 	targetTar := filepath.Join(os.TempDir(), "test_archive.tar")
 	defer os.Remove(targetTar)
 
-	err := Tar(sourceDir, targetTar, "", "", false)
+	err := Tar(context.Background(), format.Sources(sourceDir), targetTar, format.Options{})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -34,7 +44,7 @@ func TestTarArchiveWithGlob(t *testing.T) {
 	targetTar := filepath.Join(os.TempDir(), "test_glob_archive.tar")
 	defer os.Remove(targetTar)
 
-	err := Tar(sourceDir, targetTar, "", "*.txt", false)
+	err := Tar(context.Background(), format.Sources(sourceDir), targetTar, format.Options{Globs: []string{"*.txt"}})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -48,7 +58,7 @@ func TestTarArchiveWithExclude(t *testing.T) {
 	targetTar := filepath.Join(os.TempDir(), "test_exclude_archive.tar")
 	defer os.Remove(targetTar)
 
-	err := Tar(sourceDir, targetTar, "*.txt", "", false)
+	err := Tar(context.Background(), format.Sources(sourceDir), targetTar, format.Options{Excludes: []string{"*.txt"}})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -62,7 +72,7 @@ func TestUntarExtract(t *testing.T) {
 	targetTar := filepath.Join(os.TempDir(), "test_extract.tar")
 	defer os.Remove(targetTar)
 
-	err := Tar(sourceDir, targetTar, "", "", false)
+	err := Tar(context.Background(), format.Sources(sourceDir), targetTar, format.Options{})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -70,7 +80,7 @@ func TestUntarExtract(t *testing.T) {
 	extractDir := filepath.Join(os.TempDir(), "extract_test")
 	defer os.RemoveAll(extractDir)
 
-	err = Untar(targetTar, extractDir, "")
+	err = Untar(context.Background(), targetTar, extractDir, format.Options{})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -80,6 +90,49 @@ func TestUntarExtract(t *testing.T) {
 	}
 }
 
+func TestTarCompressedRoundTrip(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression string
+		target      string
+	}{
+		{"gzip", "gzip", "test_roundtrip.tar.gz"},
+		{"zstd", "zstd", "test_roundtrip.tar.zst"},
+		{"zstd tzst suffix", "zstd", "test_roundtrip.tzst"},
+		{"xz", "xz", "test_roundtrip.tar.xz"},
+		{"xz txz suffix", "xz", "test_roundtrip.txz"},
+		{"bzip2", "bzip2", "test_roundtrip.tar.bz2"},
+		{"bzip2 tbz2 suffix", "bzip2", "test_roundtrip.tbz2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sourceDir := createTestDir(t)
+			defer os.RemoveAll(sourceDir)
+
+			targetTar := filepath.Join(os.TempDir(), test.target)
+			defer os.Remove(targetTar)
+
+			err := Tar(context.Background(), format.Sources(sourceDir), targetTar, format.Options{Compression: test.compression, Long: true})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			extractDir := filepath.Join(os.TempDir(), "extract_roundtrip_test")
+			defer os.RemoveAll(extractDir)
+
+			err = Untar(context.Background(), targetTar, extractDir, format.Options{})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if _, err := os.Stat(filepath.Join(extractDir, "file1.txt")); err != nil {
+				t.Fatalf("expected file1.txt to be extracted: %v", err)
+			}
+		})
+	}
+}
+
 func createTestDir(t *testing.T) string {
 	testDir := filepath.Join(os.TempDir(), "tar_test")
 	err := os.Mkdir(testDir, 0755)
@@ -105,19 +158,19 @@ func TestTarPatterns(t *testing.T) {
 
 	tests := []struct {
 		name     string
-		glob     string
-		exclude  string
+		glob     []string
+		exclude  []string
 		expected []string
 	}{
-		{"Match all txt files", "*.txt", "", []string{"file1.txt", "file3.txt"}},
-		{"Match any file ending with file.txt", "*file.txt", "", []string{"myfile.txt"}},
-		{"Match all files in dir", "dir/*", "", []string{"dir/file1.txt", "dir/file2.log"}},
-		{"Match log files in subdirs", "dir/*/*.log", "", []string{"dir/subdir/file1.log"}},
-		{"Match with ?", "file?.txt", "", []string{"file1.txt"}},
-		{"Match exactly 3 chars before extension", "dir/???.log", "", []string{"dir/abc.log"}},
-		{"Combined * and ?", "file?*.txt", "", []string{"file1abc.txt"}},
-		{"Exclude log files", "*", "*.log", []string{"file1.txt", "file3.txt"}},
-		{"Exclude specific files", "*", "file1.txt", []string{"file3.txt", "file4.log"}},
+		{"Match all txt files", []string{"*.txt"}, nil, []string{"file1.txt", "file3.txt"}},
+		{"Match any file ending with file.txt", []string{"*file.txt"}, nil, []string{"myfile.txt"}},
+		{"Match all files in dir", []string{"dir/*"}, nil, []string{"dir/file1.txt", "dir/file2.log"}},
+		{"Match log files in subdirs", []string{"dir/*/*.log"}, nil, []string{"dir/subdir/file1.log"}},
+		{"Match with ?", []string{"file?.txt"}, nil, []string{"file1.txt"}},
+		{"Match exactly 3 chars before extension", []string{"dir/???.log"}, nil, []string{"dir/abc.log"}},
+		{"Combined * and ?", []string{"file?*.txt"}, nil, []string{"file1abc.txt"}},
+		{"Exclude log files", []string{"*"}, []string{"*.log"}, []string{"file1.txt", "file3.txt"}},
+		{"Exclude specific files", []string{"*"}, []string{"file1.txt"}, []string{"file3.txt", "file4.log"}},
 	}
 
 	for _, test := range tests {
@@ -125,10 +178,714 @@ func TestTarPatterns(t *testing.T) {
 			targetTar := filepath.Join(os.TempDir(), "test_tar_patterns.tar")
 			defer os.Remove(targetTar)
 
-			err := Tar(sourceDir, targetTar, test.exclude, test.glob, false)
+			err := Tar(context.Background(), format.Sources(sourceDir), targetTar, format.Options{Excludes: test.exclude, Globs: test.glob})
 			if err != nil {
 				t.Fatalf("expected no error, got %v", err)
 			}
 		})
 	}
 }
+
+func TestUntarDetectsCompressionWithoutExtension(t *testing.T) {
+	sourceDir := createTestDir(t)
+	defer os.RemoveAll(sourceDir)
+
+	targetTar := filepath.Join(os.TempDir(), "test_no_extension")
+	defer os.Remove(targetTar)
+
+	err := Tar(context.Background(), format.Sources(sourceDir), targetTar, format.Options{Compression: "zstd"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	extractDir := filepath.Join(os.TempDir(), "extract_no_extension_test")
+	defer os.RemoveAll(extractDir)
+
+	err = Untar(context.Background(), targetTar, extractDir, format.Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(extractDir, "file1.txt")); err != nil {
+		t.Fatalf("expected file1.txt to be extracted: %v", err)
+	}
+}
+
+func TestUntarRejectsPathTraversal(t *testing.T) {
+	for _, name := range []string{"../escape.txt", "/tmp/escape.txt", "dir/../../escape.txt"} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			targetTar := filepath.Join(dir, "malicious.tar")
+
+			file, err := os.Create(targetTar)
+			if err != nil {
+				t.Fatalf("failed to create tar file: %v", err)
+			}
+			writer := tar.NewWriter(file)
+			writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: 4, Typeflag: tar.TypeReg})
+			writer.Write([]byte("evil"))
+			writer.Close()
+			file.Close()
+
+			extractDir := filepath.Join(dir, "extract")
+			err = Untar(context.Background(), targetTar, extractDir, format.Options{})
+
+			var unsafe *fsutil.UnsafePathError
+			if !errors.As(err, &unsafe) {
+				t.Fatalf("expected UnsafePathError, got %v", err)
+			}
+			if unsafe.Entry != name {
+				t.Errorf("expected entry %q in error, got %q", name, unsafe.Entry)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "escape.txt")); !os.IsNotExist(err) {
+				t.Errorf("expected escaping entry not to be written")
+			}
+		})
+	}
+}
+
+func TestTarSymlinksAndHardlinks(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(filepath.Join(sourceDir, "lib"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "lib", "real.txt"), []byte("content"), 0644)
+	os.Symlink("lib/real.txt", filepath.Join(sourceDir, "link.txt"))
+	os.Symlink("lib", filepath.Join(sourceDir, "linkdir"))
+	if err := os.Link(filepath.Join(sourceDir, "lib", "real.txt"), filepath.Join(sourceDir, "hard.txt")); err != nil {
+		t.Skipf("hardlinks not supported: %v", err)
+	}
+
+	targetTar := filepath.Join(dir, "links.tar")
+	if err := Tar(context.Background(), format.Sources(sourceDir), targetTar, format.Options{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	headers := readHeaders(t, targetTar)
+	if h := headers["link.txt"]; h == nil || h.Typeflag != tar.TypeSymlink || h.Linkname != "lib/real.txt" {
+		t.Errorf("expected link.txt to be a symlink to lib/real.txt, got %+v", h)
+	}
+	if h := headers["linkdir"]; h == nil || h.Typeflag != tar.TypeSymlink {
+		t.Errorf("expected linkdir to be a symlink, got %+v", h)
+	}
+	// The walk visits hard.txt before lib/real.txt
+	if h := headers["lib/real.txt"]; h == nil || h.Typeflag != tar.TypeLink || h.Linkname != "hard.txt" {
+		t.Errorf("expected lib/real.txt to be a hardlink to hard.txt, got %+v", h)
+	}
+
+	extractDir := filepath.Join(dir, "extract")
+	if err := Untar(context.Background(), targetTar, extractDir, format.Options{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if link, err := os.Readlink(filepath.Join(extractDir, "link.txt")); err != nil || link != "lib/real.txt" {
+		t.Errorf("expected link.txt to be restored as symlink, got %q, %v", link, err)
+	}
+	content, err := os.ReadFile(filepath.Join(extractDir, "linkdir", "real.txt"))
+	if err != nil || string(content) != "content" {
+		t.Errorf("expected linkdir/real.txt to be readable through the symlink, got %q, %v", content, err)
+	}
+	hard, _ := os.Stat(filepath.Join(extractDir, "hard.txt"))
+	real, _ := os.Stat(filepath.Join(extractDir, "lib", "real.txt"))
+	if hard == nil || real == nil || !os.SameFile(hard, real) {
+		t.Errorf("expected hard.txt and lib/real.txt to be the same file")
+	}
+}
+
+func TestTarFollowSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(filepath.Join(sourceDir, "lib"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "lib", "real.txt"), []byte("content"), 0644)
+	os.Symlink("lib/real.txt", filepath.Join(sourceDir, "link.txt"))
+	os.Symlink("lib", filepath.Join(sourceDir, "linkdir"))
+
+	targetTar := filepath.Join(dir, "follow.tar")
+	if err := Tar(context.Background(), format.Sources(sourceDir), targetTar, format.Options{FollowSymlinks: true}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	headers := readHeaders(t, targetTar)
+	for _, name := range []string{"link.txt", "linkdir/real.txt"} {
+		if h := headers[name]; h == nil || h.Typeflag != tar.TypeReg || h.Size != int64(len("content")) {
+			t.Errorf("expected %s to be archived as a regular file, got %+v", name, h)
+		}
+	}
+	if h := headers["linkdir"]; h == nil || h.Typeflag != tar.TypeDir {
+		t.Errorf("expected linkdir to be archived as a directory, got %+v", h)
+	}
+}
+
+func TestTarFollowSymlinksLoop(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(sourceDir, 0755)
+	os.Symlink(".", filepath.Join(sourceDir, "loop"))
+
+	err := Tar(context.Background(), format.Sources(sourceDir), filepath.Join(dir, "loop.tar"), format.Options{FollowSymlinks: true})
+	if err == nil {
+		t.Fatalf("expected a symlink loop error")
+	}
+}
+
+func TestTarFollowSymlinksMutualLoop(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(filepath.Join(sourceDir, "a"), 0755)
+	os.MkdirAll(filepath.Join(sourceDir, "b"), 0755)
+	os.Symlink("../b", filepath.Join(sourceDir, "a", "l1"))
+	os.Symlink("../a", filepath.Join(sourceDir, "b", "l2"))
+
+	err := Tar(context.Background(), format.Sources(sourceDir), filepath.Join(dir, "loop.tar"), format.Options{FollowSymlinks: true})
+	if err == nil || !strings.Contains(err.Error(), "symlink loop detected") {
+		t.Fatalf("expected a symlink loop error, got %v", err)
+	}
+}
+
+func TestUntarHardlinkToSkippedEntry(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "links.tar")
+	file, _ := os.Create(source)
+	writer := tar.NewWriter(file)
+	writer.WriteHeader(&tar.Header{Name: "a.bin", Mode: 0644, Size: 4})
+	writer.Write([]byte("data"))
+	writer.WriteHeader(&tar.Header{Name: "b.txt", Typeflag: tar.TypeLink, Linkname: "a.bin"})
+	writer.WriteHeader(&tar.Header{Name: "c.txt", Mode: 0644, Size: 4})
+	writer.Write([]byte("text"))
+	writer.Close()
+	file.Close()
+
+	target := filepath.Join(dir, "extract")
+	if err := Untar(context.Background(), source, target, format.Options{Globs: []string{"*.txt"}}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected the hardlink to a skipped entry to be skipped, got %v", err)
+	}
+	if content, err := os.ReadFile(filepath.Join(target, "c.txt")); err != nil || string(content) != "text" {
+		t.Errorf("expected c.txt to be extracted, got %q, %v", content, err)
+	}
+}
+
+func TestUntarFifo(t *testing.T) {
+	dir := t.TempDir()
+	targetTar := filepath.Join(dir, "fifo.tar")
+
+	file, err := os.Create(targetTar)
+	if err != nil {
+		t.Fatalf("failed to create tar file: %v", err)
+	}
+	writer := tar.NewWriter(file)
+	writer.WriteHeader(&tar.Header{Name: "pipe", Mode: 0644, Typeflag: tar.TypeFifo})
+	writer.Close()
+	file.Close()
+
+	extractDir := filepath.Join(dir, "extract")
+	if err := Untar(context.Background(), targetTar, extractDir, format.Options{}); err != nil {
+		if errors.Is(err, errors.ErrUnsupported) {
+			t.Skip("fifos not supported on this platform")
+		}
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	info, err := os.Lstat(filepath.Join(extractDir, "pipe"))
+	if err != nil || info.Mode()&os.ModeNamedPipe == 0 {
+		t.Errorf("expected pipe to be a named pipe, got %v, %v", info, err)
+	}
+}
+
+func readHeaders(t *testing.T, path string) map[string]*tar.Header {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open tar file: %v", err)
+	}
+	defer file.Close()
+
+	headers := map[string]*tar.Header{}
+	reader := tar.NewReader(file)
+	for {
+		header, err := reader.Next()
+		if err != nil {
+			break
+		}
+		headers[header.Name] = header
+	}
+	return headers
+}
+
+func TestUntarPreserve(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(filepath.Join(sourceDir, "bin"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "bin", "tool"), []byte("#!/bin/sh"), 0755)
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	os.Chtimes(filepath.Join(sourceDir, "bin", "tool"), mtime, mtime)
+	os.Chtimes(filepath.Join(sourceDir, "bin"), mtime, mtime)
+
+	targetTar := filepath.Join(dir, "preserve.tar")
+	if err := Tar(context.Background(), format.Sources(sourceDir), targetTar, format.Options{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	extractDir := filepath.Join(dir, "extract")
+	preserve := fsutil.Preserve{Permissions: true, Times: true, Owner: true}
+	if err := Untar(context.Background(), targetTar, extractDir, format.Options{Preserve: preserve}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, name := range []string{"bin/tool", "bin"} {
+		info, err := os.Stat(filepath.Join(extractDir, name))
+		if err != nil {
+			t.Fatalf("failed to stat %s: %v", name, err)
+		}
+		if info.Mode().Perm() != 0755 {
+			t.Errorf("expected %s to have mode 0755, got %v", name, info.Mode().Perm())
+		}
+		if !info.ModTime().Equal(mtime) {
+			t.Errorf("expected %s to have mtime %v, got %v", name, mtime, info.ModTime())
+		}
+	}
+}
+
+func TestTarReproducible(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(filepath.Join(sourceDir, "sub"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "sub", "file.txt"), []byte("content"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "tool"), []byte("#!/bin/sh"), 0755)
+
+	opts := format.Options{Compression: "gzip", Reproducible: true, Epoch: fsutil.DefaultEpoch}
+
+	first := filepath.Join(dir, "first.tar.gz")
+	if err := Tar(context.Background(), format.Sources(sourceDir), first, opts); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Touch and re-permission the tree, the output must not change
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(sourceDir, "sub", "file.txt"), later, later)
+	os.Chmod(filepath.Join(sourceDir, "sub", "file.txt"), 0600)
+	os.Chmod(filepath.Join(sourceDir, "tool"), 0700)
+
+	second := filepath.Join(dir, "second.tar.gz")
+	if err := Tar(context.Background(), format.Sources(sourceDir), second, opts); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	firstBytes, _ := os.ReadFile(first)
+	secondBytes, _ := os.ReadFile(second)
+	if string(firstBytes) != string(secondBytes) {
+		t.Errorf("expected reproducible archives to be identical")
+	}
+}
+
+func TestTarList(t *testing.T) {
+	sourceDir := createTestDir(t)
+	defer os.RemoveAll(sourceDir)
+
+	targetTar := filepath.Join(os.TempDir(), "test_list.tar.zst")
+	defer os.Remove(targetTar)
+
+	if err := Tar(context.Background(), format.Sources(sourceDir), targetTar, format.Options{Compression: "zstd"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	entries, err := List(context.Background(), targetTar, format.Options{Globs: []string{"*.txt"}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(entries) != 2 || entries[0].Name != "file1.txt" || entries[1].Name != "file3.txt" {
+		t.Fatalf("expected file1.txt and file3.txt, got %+v", entries)
+	}
+	if entries[0].Type != format.TypeFile || entries[0].CompressedSize != -1 {
+		t.Errorf("expected a file with unknown compressed size, got %+v", entries[0])
+	}
+}
+
+func TestTarTest(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(sourceDir, 0755)
+	os.WriteFile(filepath.Join(sourceDir, "file.txt"), []byte("content"), 0644)
+
+	targetTar := filepath.Join(dir, "test.tar.gz")
+	if err := Tar(context.Background(), format.Sources(sourceDir), targetTar, format.Options{Compression: "gzip"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if err := Test(context.Background(), targetTar); err != nil {
+		t.Fatalf("expected intact archive to pass, got %v", err)
+	}
+
+	// Damage the gzip trailer checksum
+	content, _ := os.ReadFile(targetTar)
+	content[len(content)-8] ^= 0xff
+	os.WriteFile(targetTar, content, 0644)
+
+	var corrupted *format.CorruptError
+	if err := Test(context.Background(), targetTar); !errors.As(err, &corrupted) {
+		t.Fatalf("expected CorruptError for bad checksum, got %v", err)
+	}
+
+	// Truncate the archive
+	os.WriteFile(targetTar, content[:len(content)/2], 0644)
+	if err := Test(context.Background(), targetTar); !errors.As(err, &corrupted) {
+		t.Fatalf("expected CorruptError for truncated archive, got %v", err)
+	}
+}
+
+func TestTarTestTruncatedAtEntry(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "plain.tar")
+	file, _ := os.Create(source)
+	writer := tar.NewWriter(file)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		content := strings.Repeat("x", 600)
+		writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})
+		writer.Write([]byte(content))
+	}
+	writer.Close()
+	file.Close()
+
+	if err := Test(context.Background(), source); err != nil {
+		t.Fatalf("expected intact archive to pass, got %v", err)
+	}
+
+	// Cut after the first entry, after the last entry and within the two
+	// zero blocks that end the archive
+	content, _ := os.ReadFile(source)
+	for _, size := range []int{1536, 3072, 3584} {
+		os.WriteFile(source, content[:size], 0644)
+		var corrupted *format.CorruptError
+		if err := Test(context.Background(), source); !errors.As(err, &corrupted) {
+			t.Errorf("expected CorruptError for an archive cut to %d bytes, got %v", size, err)
+		}
+	}
+}
+
+func TestTarChecksumSums(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(sourceDir, 0755)
+	os.WriteFile(filepath.Join(sourceDir, "file.txt"), []byte("content"), 0644)
+
+	targetTar := filepath.Join(dir, "checksum.tar.gz")
+	opts := format.Options{Compression: "gzip", Checksums: []string{"sha256"}, ChecksumOutput: "sums"}
+	if err := Tar(context.Background(), format.Sources(sourceDir), targetTar, opts); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	content, _ := os.ReadFile(targetTar)
+	sum := sha256.Sum256(content)
+	expected := hex.EncodeToString(sum[:]) + "  checksum.tar.gz\n"
+
+	sums, err := os.ReadFile(filepath.Join(dir, "SHA256SUMS"))
+	if err != nil || string(sums) != expected {
+		t.Errorf("expected SHA256SUMS %q, got %q, %v", expected, sums, err)
+	}
+}
+
+func TestTarMultipleSources(t *testing.T) {
+	dir := t.TempDir()
+	distDir := filepath.Join(dir, "dist")
+	os.MkdirAll(distDir, 0755)
+	os.WriteFile(filepath.Join(distDir, "app"), []byte("binary"), 0755)
+	os.WriteFile(filepath.Join(distDir, "app.log"), []byte("log"), 0644)
+	readme := filepath.Join(dir, "README.md")
+	os.WriteFile(readme, []byte("readme"), 0644)
+
+	targetTar := filepath.Join(dir, "bundle.tar")
+	sources := []format.Source{
+		{Path: distDir, Prefix: "bundle/bin"},
+		{Path: readme, Prefix: "bundle"},
+	}
+	opts := format.Options{Excludes: []string{"**/*.log"}}
+	if err := Tar(context.Background(), sources, targetTar, opts); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	entries, err := List(context.Background(), targetTar, format.Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	expected := []string{"bundle/bin", "bundle/bin/app", "bundle/README.md"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected entries %v, got %v", expected, names)
+	}
+}
+
+func TestTarPatternsRelativeToSource(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(filepath.Join(sourceDir, "node_modules", "pkg"), 0755)
+	os.MkdirAll(filepath.Join(sourceDir, "logs"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "node_modules", "pkg", "index.js"), []byte("js"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "logs", "app.log"), []byte("log"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "main.go"), []byte("go"), 0644)
+
+	targetTar := filepath.Join(dir, "patterns.tar")
+	opts := format.Options{Excludes: []string{"node_modules/**", "*.log"}}
+	if err := Tar(context.Background(), format.Sources(sourceDir), targetTar, opts); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	entries, err := List(context.Background(), targetTar, format.Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	expected := []string{"logs", "main.go"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected entries %v, got %v", expected, names)
+	}
+}
+
+func TestTarIgnoreFiles(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(filepath.Join(sourceDir, "build"), 0755)
+	os.MkdirAll(filepath.Join(sourceDir, "web", "dist"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, ".gitignore"), []byte("build/\n*.log\n"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "build", "app"), []byte("binary"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "debug.log"), []byte("log"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "main.go"), []byte("go"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "web", ".archiveignore"), []byte("/dist\n!keep.log\n"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "web", "dist", "bundle.js"), []byte("js"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "web", "keep.log"), []byte("log"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "web", "other.log"), []byte("log"), 0644)
+	ignoreFile := filepath.Join(dir, "extra.ignore")
+	os.WriteFile(ignoreFile, []byte("main.go\n"), 0644)
+
+	targetTar := filepath.Join(dir, "ignore.tar")
+	opts := format.Options{
+		IgnoreFile:  ignoreFile,
+		IgnoreNames: []string{".gitignore", ".archiveignore"},
+	}
+	if err := Tar(context.Background(), format.Sources(sourceDir), targetTar, opts); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	entries, err := List(context.Background(), targetTar, format.Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	expected := []string{".gitignore", "web", "web/.archiveignore", "web/keep.log"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected entries %v, got %v", expected, names)
+	}
+}
+
+func TestTarStripComponentsAndPrefix(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(filepath.Join(sourceDir, "project-1.2.3", "src"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "project-1.2.3", "README"), []byte("readme"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "project-1.2.3", "src", "main.go"), []byte("go"), 0644)
+	os.Link(filepath.Join(sourceDir, "project-1.2.3", "README"), filepath.Join(sourceDir, "project-1.2.3", "src", "README"))
+
+	targetTar := filepath.Join(dir, "project.tar")
+	if err := Tar(context.Background(), format.Sources(sourceDir), targetTar, format.Options{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	extractDir := filepath.Join(dir, "extract")
+	opts := format.Options{StripComponents: 1, Prefix: "project"}
+	if err := Untar(context.Background(), targetTar, extractDir, opts); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, name := range []string{"project/README", "project/src/main.go", "project/src/README"} {
+		if _, err := os.Stat(filepath.Join(extractDir, name)); err != nil {
+			t.Errorf("expected %s to be extracted: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(extractDir, "project-1.2.3")); !os.IsNotExist(err) {
+		t.Errorf("expected project-1.2.3 to be stripped, got %v", err)
+	}
+
+	// Strip and prefix apply when archiving as well
+	rerooted := filepath.Join(dir, "rerooted.tar")
+	if err := Tar(context.Background(), format.Sources(sourceDir), rerooted, opts); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	entries, err := List(context.Background(), rerooted, format.Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, entry := range entries {
+		if entry.Name != "project" && !strings.HasPrefix(entry.Name, "project/") {
+			t.Errorf("expected entries below project, got %s", entry.Name)
+		}
+	}
+}
+
+func TestTarFailureKeepsTarget(t *testing.T) {
+	dir := t.TempDir()
+	targetTar := filepath.Join(dir, "archive.tar")
+	os.WriteFile(targetTar, []byte("previous archive"), 0644)
+
+	err := Tar(context.Background(), format.Sources(filepath.Join(dir, "missing")), targetTar, format.Options{})
+	if err == nil {
+		t.Fatalf("expected an error for a missing source")
+	}
+
+	if content, _ := os.ReadFile(targetTar); string(content) != "previous archive" {
+		t.Errorf("expected the previous archive to be kept, got %q", content)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected no temporary files to be left, got %v", entries)
+	}
+}
+
+func TestUntarConflicts(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(sourceDir, 0755)
+	os.WriteFile(filepath.Join(sourceDir, "config.yml"), []byte("archived"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "new.txt"), []byte("new"), 0644)
+
+	targetTar := filepath.Join(dir, "archive.tar")
+	if err := Tar(context.Background(), format.Sources(sourceDir), targetTar, format.Options{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		conflict string
+		expected map[string]string
+		fail     bool
+	}{
+		{format.ConflictFail, nil, true},
+		{format.ConflictSkip, map[string]string{"config.yml": "workspace", "new.txt": "new"}, false},
+		{format.ConflictOverwrite, map[string]string{"config.yml": "archived", "new.txt": "new"}, false},
+		{format.ConflictRename, map[string]string{"config.yml": "workspace", "config-1.yml": "archived"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.conflict, func(t *testing.T) {
+			// Extract into a pre-populated workspace
+			workspace := t.TempDir()
+			os.WriteFile(filepath.Join(workspace, "config.yml"), []byte("workspace"), 0644)
+			os.WriteFile(filepath.Join(workspace, "README"), []byte("readme"), 0644)
+
+			err := Untar(context.Background(), targetTar, workspace, format.Options{Conflict: test.conflict})
+			if test.fail {
+				var conflict *format.ConflictError
+				if !errors.As(err, &conflict) {
+					t.Fatalf("expected ConflictError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			for name, expected := range test.expected {
+				if content, _ := os.ReadFile(filepath.Join(workspace, name)); string(content) != expected {
+					t.Errorf("expected %s to contain %q, got %q", name, expected, content)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(workspace, "README")); err != nil {
+				t.Errorf("expected README to be kept: %v", err)
+			}
+		})
+	}
+}
+
+func TestUntarLimits(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "limits.tar")
+	file, _ := os.Create(source)
+	writer := tar.NewWriter(file)
+	for _, name := range []string{"a.txt", "b.txt", "sub/c.txt"} {
+		content := strings.Repeat("x", 600)
+		writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})
+		writer.Write([]byte(content))
+	}
+	writer.Close()
+	file.Close()
+
+	tests := []struct {
+		name   string
+		limits format.Limits
+	}{
+		{"total size", format.Limits{MaxTotalSize: 1000}},
+		{"file size", format.Limits{MaxFileSize: 100}},
+		{"entries", format.Limits{MaxEntries: 2}},
+		{"depth", format.Limits{MaxDepth: 1}},
+		{"ratio", format.Limits{MaxRatio: 0.3}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Extract into an existing directory, whose files must survive
+			target := t.TempDir()
+			os.WriteFile(filepath.Join(target, "keep.txt"), []byte("keep"), 0644)
+
+			var limited *format.LimitError
+			err := Untar(context.Background(), source, target, format.Options{Limits: test.limits})
+			if !errors.As(err, &limited) {
+				t.Fatalf("expected LimitError, got %v", err)
+			}
+
+			entries, _ := os.ReadDir(target)
+			if len(entries) != 1 || entries[0].Name() != "keep.txt" {
+				t.Errorf("expected only keep.txt to be left, got %v", entries)
+			}
+		})
+	}
+}
+
+func TestTarFlatten(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "dist")
+	os.MkdirAll(filepath.Join(sourceDir, "a"), 0755)
+	os.MkdirAll(filepath.Join(sourceDir, "b"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "a", "x.jar"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "b", "x.jar"), []byte("b"), 0644)
+
+	opts := format.Options{Flatten: true, FlattenCollision: format.CollisionOverwrite}
+	targetTar := filepath.Join(dir, "flat.tar")
+	if err := Tar(context.Background(), format.Sources(sourceDir), targetTar, opts); err == nil {
+		t.Fatalf("expected overwrite to be rejected when archiving")
+	}
+
+	opts.FlattenCollision = format.CollisionRename
+	if err := Tar(context.Background(), format.Sources(sourceDir), targetTar, opts); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	headers := readHeaders(t, targetTar)
+	if len(headers) != 2 || headers["x.jar"] == nil || headers["x-1.jar"] == nil {
+		t.Fatalf("expected x.jar and x-1.jar, got %v", headers)
+	}
+
+	// Extracting a tree flattened overwrites with the later file
+	treeTar := filepath.Join(dir, "tree.tar")
+	if err := Tar(context.Background(), format.Sources(sourceDir), treeTar, format.Options{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	extractDir := filepath.Join(dir, "lib")
+	opts.FlattenCollision = format.CollisionOverwrite
+	if err := Untar(context.Background(), treeTar, extractDir, opts); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	entries, _ := os.ReadDir(extractDir)
+	content, _ := os.ReadFile(filepath.Join(extractDir, "x.jar"))
+	if len(entries) != 1 || string(content) != "b" {
+		t.Errorf("expected a single x.jar from b, got %v, %q", entries, content)
+	}
+}
@@ -6,46 +6,107 @@ package zip
 
 import (
 	"archive/zip"
+	"context"
 	"fmt"
-	"github.com/bmatcuk/doublestar/v4"
+	"github.com/harness-community/drone-archive/plugin/checksum"
+	"github.com/harness-community/drone-archive/plugin/format"
+	"github.com/harness-community/drone-archive/plugin/fsutil"
+	"github.com/harness-community/drone-archive/plugin/match"
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
 )
 
-func Zip(source, target, excludePattern, globPattern string) error {
-	zipfile, err := os.Create(target)
+func init() {
+	format.Register("zip", zipFormat{})
+}
+
+type zipFormat struct{}
+
+func (zipFormat) Archive(ctx context.Context, sources []format.Source, target string, opts format.Options) error {
+	return Zip(ctx, sources, target, opts)
+}
+
+func (zipFormat) Extract(ctx context.Context, source, target string, opts format.Options) error {
+	return Unzip(ctx, source, target, opts)
+}
+
+func (zipFormat) List(ctx context.Context, source string, opts format.Options) ([]format.Entry, error) {
+	return List(ctx, source, opts)
+}
+
+func (zipFormat) Test(ctx context.Context, source string, opts format.Options) error {
+	return Test(ctx, source)
+}
+
+// Zip writes the files and directories of every source to the zip file
+// at target. The contents of a directory source are stored under its
+// prefix, or its base name if it has none.
+func Zip(ctx context.Context, sources []format.Source, target string, opts format.Options) error {
+	// Write to a temporary file that replaces the target once complete
+	zipfile, err := fsutil.CreateAtomic(target, 0644)
+	if err != nil {
+		return err
+	}
+	defer zipfile.Cleanup()
+
+	// Checksum the archive while it is written
+	hashed, err := checksum.NewWriter(zipfile, opts.Checksums)
 	if err != nil {
 		return err
 	}
-	defer zipfile.Close()
 
-	archive := zip.NewWriter(zipfile)
+	archive := zip.NewWriter(hashed)
 	defer archive.Close()
 
-	info, err := os.Stat(source)
+	namer, err := format.NewArchiveNamer(opts)
 	if err != nil {
 		return err
 	}
 
-	var baseDir string
-	if info.IsDir() {
-		baseDir = filepath.Base(source)
+	for _, source := range sources {
+		if err := addSource(ctx, archive, source, namer, opts); err != nil {
+			return err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	if err := zipfile.Commit(); err != nil {
+		return err
 	}
+	return hashed.Save(target, opts.ChecksumOutput)
+}
 
-	return filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+func addSource(ctx context.Context, archive *zip.Writer, source format.Source, namer *format.Namer, opts format.Options) error {
+	info, err := os.Stat(source.Path)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() && source.Prefix == "" {
+		source.Prefix = filepath.Base(source.Path)
+	}
+
+	filter, err := format.NewFilter(opts)
+	if err != nil {
+		return err
+	}
+
+	return filepath.Walk(source.Path, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-		// Apply glob and exclude patterns
-		matchesGlob, _ := doublestar.Match(globPattern, path)
-		matchesExclude, _ := doublestar.Match(excludePattern, path)
-
-		if (globPattern != "" && !matchesGlob) || (excludePattern != "" && matchesExclude) {
-			// Skip this file or directory
-			return nil
+		// Apply the glob, exclude and ignore rules to the path relative
+		// to the source
+		if selected, err := filter.Visit(source.Rel(path, info), path, info); !selected {
+			// Skip this file, err is SkipDir for an excluded directory
+			return err
 		}
 
 		header, err := zip.FileInfoHeader(info)
@@ -53,10 +114,20 @@ func Zip(source, target, excludePattern, globPattern string) error {
 			return err
 		}
 
-		if baseDir != "" {
-			header.Name = filepath.Join(baseDir, strings.TrimPrefix(path, source))
+		if opts.Reproducible {
+			header.Modified = fsutil.ClampTime(header.Modified, opts.Epoch)
+			header.SetMode(fsutil.NormalizeMode(info.Mode()))
 		}
 
+		// The root of a source without prefix, entries left without a
+		// name after stripping components and directories in flatten
+		// mode are not archived
+		name, ok, err := namer.Name(source.EntryName(path, info), info.IsDir())
+		if !ok {
+			return err
+		}
+		header.Name = name
+
 		if info.IsDir() {
 			header.Name += "/"
 		} else {
@@ -77,64 +148,214 @@ func Zip(source, target, excludePattern, globPattern string) error {
 			return err
 		}
 		defer file.Close()
-		_, err = io.Copy(writer, file)
+		_, err = fsutil.Copy(ctx, writer, file)
 		return err
 	})
 }
 
-func Unzip(source, target, globPattern string) error {
+func Unzip(ctx context.Context, source, target string, opts format.Options) (err error) {
+	// Zip entries carry no ownership, never chown to uid 0
+	preserve := opts.Preserve
+	preserve.Owner = false
+
 	reader, err := zip.OpenReader(source)
 	if err != nil {
 		return err
 	}
 	defer reader.Close()
 
+	// An aborted extraction removes what it created, but nothing that
+	// was there before
+	var created fsutil.Created
+	defer func() {
+		if format.Aborted(ctx, err) {
+			created.Remove()
+		}
+	}()
+
 	// Create the target directory if it doesn't exist
-	if err := os.MkdirAll(target, 0755); err != nil {
+	if err := created.MkdirAll(target, 0755); err != nil {
+		return err
+	}
+
+	namer, err := format.NewNamer(opts)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(source)
+	if err != nil {
 		return err
 	}
+	limiter := format.NewLimiter(opts.Limits, info.Size())
+
+	var dirs fsutil.PendingDirs
+
+	conflicts := format.NewConflicts(opts)
 
 	for _, file := range reader.File {
-		matchesGlob, _ := doublestar.Match(globPattern, file.Name)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-		if globPattern != "" && !matchesGlob {
+		if !match.Selected(file.Name, opts.Globs, nil) {
 			// Skip this file
 			continue
 		}
 
-		path := filepath.Join(target, file.Name)
+		name, ok, err := namer.Name(file.Name, file.FileInfo().IsDir())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// Nothing is left of the name after stripping components, or
+			// a directory in flatten mode
+			continue
+		}
+
+		if err := limiter.Entry(name, int64(file.UncompressedSize64)); err != nil {
+			return err
+		}
 
-		// Check if the file path is within the target directory
-		if !strings.HasPrefix(path, filepath.Clean(target)+string(os.PathSeparator)) {
-			return fmt.Errorf("invalid file path: %s", path)
+		// Make sure the entry stays within the target directory
+		path, err := fsutil.SecureJoin(target, name)
+		if err != nil {
+			return err
 		}
 
 		if file.FileInfo().IsDir() {
-			os.MkdirAll(path, file.Mode())
+			created.MkdirAll(path, file.Mode())
+			dirs.Add(path, metadata(file))
+			continue
+		}
+
+		// Existing directories are merged, existing files are handled
+		// according to the conflict policy
+		path, err = conflicts.Resolve(path, file.Modified)
+		if err != nil {
+			return err
+		}
+		if path == "" {
+			fmt.Printf("Skipping existing file: %s\n", name)
 			continue
 		}
 
 		// Ensure the parent directory of the file exists
-		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		if err := created.MkdirAll(filepath.Dir(path), 0755); err != nil {
 			return err
 		}
 
-		fileReader, err := file.Open()
-		if err != nil {
+		// Replace rather than write through an existing symlink
+		created.Add(path)
+		if err := fsutil.RemoveExisting(path); err != nil {
 			return err
 		}
-		defer fileReader.Close()
 
-		targetFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode())
-		if err != nil {
+		if err := extractFile(ctx, file, name, path, limiter); err != nil {
 			return err
 		}
-		defer targetFile.Close()
 
-		_, err = io.Copy(targetFile, fileReader)
-		if err != nil {
+		if err := preserve.Restore(path, metadata(file)); err != nil {
 			return err
 		}
 	}
+
+	return dirs.Restore(preserve)
+}
+
+// extractFile writes the contents of the zip entry extracted as name to
+// path. Both the entry and the written file are closed before it returns.
+func extractFile(ctx context.Context, file *zip.File, name, path string, limiter *format.Limiter) error {
+	fileReader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer fileReader.Close()
+
+	return fsutil.WriteFile(ctx, path, limiter.Reader(name, fileReader), file.Mode())
+}
+
+func metadata(file *zip.File) fsutil.Metadata {
+	return fsutil.Metadata{
+		Mode:    file.Mode(),
+		ModTime: file.Modified,
+	}
+}
+
+// List returns the entries of the zip file at source that match the glob
+// patterns.
+func List(ctx context.Context, source string, opts format.Options) ([]format.Entry, error) {
+	reader, err := zip.OpenReader(source)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var entries []format.Entry
+	for _, file := range reader.File {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if !match.Selected(file.Name, opts.Globs, nil) {
+			continue
+		}
+
+		entryType := format.TypeFile
+		switch {
+		case file.FileInfo().IsDir():
+			entryType = format.TypeDir
+		case file.Mode()&os.ModeSymlink != 0:
+			entryType = format.TypeSymlink
+		case !file.Mode().IsRegular():
+			entryType = format.TypeOther
+		}
+
+		entries = append(entries, format.Entry{
+			Name:           file.Name,
+			Type:           entryType,
+			Size:           int64(file.UncompressedSize64),
+			CompressedSize: int64(file.CompressedSize64),
+			Mode:           file.Mode(),
+			ModTime:        file.Modified,
+		})
+	}
+	return entries, nil
+}
+
+// Test reads every entry of the zip file at source without writing to
+// disk, verifying the CRC32 of each, and reports all corrupted entries.
+func Test(ctx context.Context, source string) error {
+	reader, err := zip.OpenReader(source)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	var corrupted []format.CorruptEntry
+	for _, file := range reader.File {
+		if err := testEntry(ctx, file); err != nil {
+			// A cancelled test says nothing about the archive
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			corrupted = append(corrupted, format.CorruptEntry{Name: file.Name, Err: err})
+		}
+	}
+
+	if len(corrupted) > 0 {
+		return &format.CorruptError{Source: source, Entries: corrupted}
+	}
 	return nil
 }
+
+func testEntry(ctx context.Context, file *zip.File) error {
+	fileReader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer fileReader.Close()
+
+	_, err = fsutil.Copy(ctx, io.Discard, fileReader)
+	return err
+}
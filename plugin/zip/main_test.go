@@ -5,9 +5,19 @@
 package zip
 
 import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/harness-community/drone-archive/plugin/format"
+	"github.com/harness-community/drone-archive/plugin/fsutil"
 )
 
 func TestZipArchive(t *testing.T) {
@@ -17,7 +27,7 @@ func TestZipArchive(t *testing.T) {
 	targetZip := filepath.Join(os.TempDir(), "test_archive.zip")
 	defer os.Remove(targetZip)
 
-	err := Zip(sourceDir, targetZip, "", "")
+	err := Zip(context.Background(), format.Sources(sourceDir), targetZip, format.Options{})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -34,7 +44,7 @@ func TestZipArchiveWithGlob(t *testing.T) {
 	targetZip := filepath.Join(os.TempDir(), "test_glob_archive.zip")
 	defer os.Remove(targetZip)
 
-	err := Zip(sourceDir, targetZip, "", "*.txt")
+	err := Zip(context.Background(), format.Sources(sourceDir), targetZip, format.Options{Globs: []string{"*.txt"}})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -48,7 +58,7 @@ func TestZipArchiveWithExclude(t *testing.T) {
 	targetZip := filepath.Join(os.TempDir(), "test_exclude_archive.zip")
 	defer os.Remove(targetZip)
 
-	err := Zip(sourceDir, targetZip, "*.txt", "")
+	err := Zip(context.Background(), format.Sources(sourceDir), targetZip, format.Options{Excludes: []string{"*.txt"}})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -62,7 +72,7 @@ func TestUnzipExtract(t *testing.T) {
 	targetZip := filepath.Join(os.TempDir(), "test_extract.zip")
 	defer os.Remove(targetZip)
 
-	err := Zip(sourceDir, targetZip, "", "")
+	err := Zip(context.Background(), format.Sources(sourceDir), targetZip, format.Options{})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -70,7 +80,7 @@ func TestUnzipExtract(t *testing.T) {
 	extractDir := filepath.Join(os.TempDir(), "extract_test")
 	defer os.RemoveAll(extractDir)
 
-	err = Unzip(targetZip, extractDir, "")
+	err = Unzip(context.Background(), targetZip, extractDir, format.Options{})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -105,19 +115,19 @@ func TestZipPatterns(t *testing.T) {
 
 	tests := []struct {
 		name     string
-		glob     string
-		exclude  string
+		glob     []string
+		exclude  []string
 		expected []string
 	}{
-		{"Match all txt files", "*.txt", "", []string{"file1.txt", "file3.txt"}},
-		{"Match any file ending with file.txt", "*file.txt", "", []string{"myfile.txt"}},
-		{"Match all files in dir", "dir/*", "", []string{"dir/file1.txt", "dir/file2.log"}},
-		{"Match log files in subdirs", "dir/*/*.log", "", []string{"dir/subdir/file1.log"}},
-		{"Match with ?", "file?.txt", "", []string{"file1.txt"}},
-		{"Match exactly 3 chars before extension", "dir/???.log", "", []string{"dir/abc.log"}},
-		{"Combined * and ?", "file?*.txt", "", []string{"file1abc.txt"}},
-		{"Exclude log files", "*", "*.log", []string{"file1.txt", "file3.txt"}},
-		{"Exclude specific files", "*", "file1.txt", []string{"file3.txt", "file4.log"}},
+		{"Match all txt files", []string{"*.txt"}, nil, []string{"file1.txt", "file3.txt"}},
+		{"Match any file ending with file.txt", []string{"*file.txt"}, nil, []string{"myfile.txt"}},
+		{"Match all files in dir", []string{"dir/*"}, nil, []string{"dir/file1.txt", "dir/file2.log"}},
+		{"Match log files in subdirs", []string{"dir/*/*.log"}, nil, []string{"dir/subdir/file1.log"}},
+		{"Match with ?", []string{"file?.txt"}, nil, []string{"file1.txt"}},
+		{"Match exactly 3 chars before extension", []string{"dir/???.log"}, nil, []string{"dir/abc.log"}},
+		{"Combined * and ?", []string{"file?*.txt"}, nil, []string{"file1abc.txt"}},
+		{"Exclude log files", []string{"*"}, []string{"*.log"}, []string{"file1.txt", "file3.txt"}},
+		{"Exclude specific files", []string{"*"}, []string{"file1.txt"}, []string{"file3.txt", "file4.log"}},
 	}
 
 	for _, test := range tests {
@@ -125,7 +135,7 @@ func TestZipPatterns(t *testing.T) {
 			targetZip := filepath.Join(os.TempDir(), "test_zip_patterns.zip")
 			defer os.Remove(targetZip)
 
-			err := Zip(sourceDir, targetZip, test.exclude, test.glob)
+			err := Zip(context.Background(), format.Sources(sourceDir), targetZip, format.Options{Excludes: test.exclude, Globs: test.glob})
 			if err != nil {
 				t.Fatalf("expected no error, got %v", err)
 			}
@@ -141,19 +151,19 @@ func TestUnzipPatterns(t *testing.T) {
 	targetZip := filepath.Join(os.TempDir(), "test_extract_patterns.zip")
 	defer os.Remove(targetZip)
 
-	err := Zip(sourceDir, targetZip, "", "")
+	err := Zip(context.Background(), format.Sources(sourceDir), targetZip, format.Options{})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
 	tests := []struct {
 		name     string
-		glob     string
+		glob     []string
 		expected []string
 	}{
-		{"Extract all txt files", "*.txt", []string{"file1.txt", "file3.txt"}},
-		{"Extract log files", "*.log", []string{"file2.log"}},
-		{"Extract files with ?", "file?.txt", []string{"file1.txt"}},
+		{"Extract all txt files", []string{"*.txt"}, []string{"file1.txt", "file3.txt"}},
+		{"Extract log files", []string{"*.log"}, []string{"file2.log"}},
+		{"Extract files with ?", []string{"file?.txt"}, []string{"file1.txt"}},
 	}
 
 	for _, test := range tests {
@@ -161,7 +171,7 @@ func TestUnzipPatterns(t *testing.T) {
 			extractDir := filepath.Join(os.TempDir(), "extract_test")
 			defer os.RemoveAll(extractDir)
 
-			err := Unzip(targetZip, extractDir, test.glob)
+			err := Unzip(context.Background(), targetZip, extractDir, format.Options{Globs: test.glob})
 			if err != nil {
 				t.Fatalf("expected no error, got %v", err)
 			}
@@ -169,3 +179,403 @@ func TestUnzipPatterns(t *testing.T) {
 		})
 	}
 }
+
+func TestUnzipRejectsPathTraversal(t *testing.T) {
+	dir := t.TempDir()
+	targetZip := filepath.Join(dir, "malicious.zip")
+
+	file, err := os.Create(targetZip)
+	if err != nil {
+		t.Fatalf("failed to create zip file: %v", err)
+	}
+	writer := zip.NewWriter(file)
+	entry, _ := writer.Create("../escape.txt")
+	entry.Write([]byte("evil"))
+	writer.Close()
+	file.Close()
+
+	err = Unzip(context.Background(), targetZip, filepath.Join(dir, "extract"), format.Options{})
+
+	var unsafe *fsutil.UnsafePathError
+	if !errors.As(err, &unsafe) {
+		t.Fatalf("expected UnsafePathError, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected escaping entry not to be written")
+	}
+}
+
+func TestUnzipPreserve(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(sourceDir, 0755)
+	os.WriteFile(filepath.Join(sourceDir, "tool"), []byte("#!/bin/sh"), 0755)
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	os.Chtimes(filepath.Join(sourceDir, "tool"), mtime, mtime)
+
+	targetZip := filepath.Join(dir, "preserve.zip")
+	if err := Zip(context.Background(), format.Sources(sourceDir), targetZip, format.Options{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	extractDir := filepath.Join(dir, "extract")
+	preserve := fsutil.Preserve{Permissions: true, Times: true}
+	if err := Unzip(context.Background(), targetZip, extractDir, format.Options{Preserve: preserve}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(extractDir, "source", "tool"))
+	if err != nil {
+		t.Fatalf("failed to stat extracted file: %v", err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("expected mode 0755, got %v", info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("expected mtime %v, got %v", mtime, info.ModTime())
+	}
+}
+
+func TestZipReproducible(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(filepath.Join(sourceDir, "sub"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "sub", "file.txt"), []byte("content"), 0644)
+
+	opts := format.Options{Reproducible: true, Epoch: fsutil.DefaultEpoch}
+
+	first := filepath.Join(dir, "first.zip")
+	if err := Zip(context.Background(), format.Sources(sourceDir), first, opts); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Touch and re-permission the tree, the output must not change
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(sourceDir, "sub", "file.txt"), later, later)
+	os.Chmod(filepath.Join(sourceDir, "sub", "file.txt"), 0600)
+
+	second := filepath.Join(dir, "second.zip")
+	if err := Zip(context.Background(), format.Sources(sourceDir), second, opts); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	firstBytes, _ := os.ReadFile(first)
+	secondBytes, _ := os.ReadFile(second)
+	if string(firstBytes) != string(secondBytes) {
+		t.Errorf("expected reproducible archives to be identical")
+	}
+}
+
+func TestZipList(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(sourceDir, 0755)
+	os.WriteFile(filepath.Join(sourceDir, "file.txt"), []byte(strings.Repeat("a", 1000)), 0644)
+
+	targetZip := filepath.Join(dir, "list.zip")
+	if err := Zip(context.Background(), format.Sources(sourceDir), targetZip, format.Options{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	entries, err := List(context.Background(), targetZip, format.Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected directory and file entries, got %+v", entries)
+	}
+	if entries[0].Type != format.TypeDir {
+		t.Errorf("expected first entry to be a directory, got %+v", entries[0])
+	}
+
+	file := entries[1]
+	if file.Name != "source/file.txt" || file.Type != format.TypeFile || file.Size != 1000 {
+		t.Errorf("unexpected file entry %+v", file)
+	}
+	if ratio, ok := file.Ratio(); !ok || ratio <= 0 {
+		t.Errorf("expected a positive compression ratio, got %v", ratio)
+	}
+}
+
+func TestZipTest(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(sourceDir, 0755)
+	os.WriteFile(filepath.Join(sourceDir, "a.txt"), []byte(strings.Repeat("a", 1000)), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "b.txt"), []byte(strings.Repeat("b", 1000)), 0644)
+
+	targetZip := filepath.Join(dir, "test.zip")
+	if err := Zip(context.Background(), format.Sources(sourceDir), targetZip, format.Options{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if err := Test(context.Background(), targetZip); err != nil {
+		t.Fatalf("expected intact archive to pass, got %v", err)
+	}
+
+	// Overwrite the CRC32 of a.txt in the central directory, it sits 30
+	// bytes before the file name
+	content, _ := os.ReadFile(targetZip)
+	offset := strings.LastIndex(string(content), "source/a.txt") - 30
+	copy(content[offset:], []byte{0xde, 0xad, 0xbe, 0xef})
+	os.WriteFile(targetZip, content, 0644)
+
+	err := Test(context.Background(), targetZip)
+	var corrupted *format.CorruptError
+	if !errors.As(err, &corrupted) {
+		t.Fatalf("expected CorruptError, got %v", err)
+	}
+	if len(corrupted.Entries) != 1 || corrupted.Entries[0].Name != "source/a.txt" {
+		t.Errorf("expected source/a.txt to be reported, got %+v", corrupted.Entries)
+	}
+}
+
+func TestZipChecksums(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(sourceDir, 0755)
+	os.WriteFile(filepath.Join(sourceDir, "file.txt"), []byte("content"), 0644)
+
+	targetZip := filepath.Join(dir, "checksum.zip")
+	opts := format.Options{Checksums: []string{"sha256", "sha512"}}
+	if err := Zip(context.Background(), format.Sources(sourceDir), targetZip, opts); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	content, _ := os.ReadFile(targetZip)
+	sum := sha256.Sum256(content)
+	expected := hex.EncodeToString(sum[:]) + "  checksum.zip\n"
+
+	sidecar, err := os.ReadFile(targetZip + ".sha256")
+	if err != nil || string(sidecar) != expected {
+		t.Errorf("expected sidecar %q, got %q, %v", expected, sidecar, err)
+	}
+	if _, err := os.Stat(targetZip + ".sha512"); err != nil {
+		t.Errorf("expected sha512 sidecar: %v", err)
+	}
+}
+
+func TestZipMultipleSources(t *testing.T) {
+	dir := t.TempDir()
+	distDir := filepath.Join(dir, "dist")
+	os.MkdirAll(distDir, 0755)
+	os.WriteFile(filepath.Join(distDir, "app"), []byte("binary"), 0755)
+	docsDir := filepath.Join(dir, "docs")
+	os.MkdirAll(docsDir, 0755)
+	os.WriteFile(filepath.Join(docsDir, "guide.md"), []byte("guide"), 0644)
+	readme := filepath.Join(dir, "README.md")
+	os.WriteFile(readme, []byte("readme"), 0644)
+
+	targetZip := filepath.Join(dir, "bundle.zip")
+	sources := []format.Source{
+		{Path: distDir},
+		{Path: docsDir, Prefix: "bundle/docs"},
+		{Path: readme},
+	}
+	if err := Zip(context.Background(), sources, targetZip, format.Options{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	entries, err := List(context.Background(), targetZip, format.Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	expected := []string{"dist/", "dist/app", "bundle/docs/", "bundle/docs/guide.md", "README.md"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected entries %v, got %v", expected, names)
+	}
+}
+
+func TestZipPatternsRelativeToSource(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(filepath.Join(sourceDir, "docs", "api"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "docs", "api", "index.md"), []byte("api"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "docs", "notes.txt"), []byte("notes"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "README.md"), []byte("readme"), 0644)
+
+	targetZip := filepath.Join(dir, "patterns.zip")
+	opts := format.Options{Globs: []string{"*.md"}, Excludes: []string{"docs/api/"}}
+	if err := Zip(context.Background(), format.Sources(sourceDir), targetZip, opts); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	entries, err := List(context.Background(), targetZip, format.Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	expected := []string{"source/", "source/README.md"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected entries %v, got %v", expected, names)
+	}
+}
+
+func TestZipReplaceBaseDir(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(sourceDir, 0755)
+	os.WriteFile(filepath.Join(sourceDir, "file.txt"), []byte("content"), 0644)
+
+	targetZip := filepath.Join(dir, "release.zip")
+	opts := format.Options{StripComponents: 1, Prefix: "release-1.0"}
+	if err := Zip(context.Background(), format.Sources(sourceDir), targetZip, opts); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	entries, err := List(context.Background(), targetZip, format.Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "release-1.0/file.txt" {
+		t.Fatalf("expected release-1.0/file.txt, got %+v", entries)
+	}
+
+	extractDir := filepath.Join(dir, "extract")
+	if err := Unzip(context.Background(), targetZip, extractDir, format.Options{StripComponents: 1}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(extractDir, "file.txt")); err != nil {
+		t.Errorf("expected file.txt to be extracted: %v", err)
+	}
+}
+
+func TestUnzipFlatten(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "dist")
+	os.MkdirAll(filepath.Join(sourceDir, "lib"), 0755)
+	os.MkdirAll(filepath.Join(sourceDir, "plugins", "auth"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "lib", "core.jar"), []byte("core"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "plugins", "auth", "core.jar"), []byte("auth"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "README"), []byte("readme"), 0644)
+
+	targetZip := filepath.Join(dir, "dist.zip")
+	if err := Zip(context.Background(), format.Sources(sourceDir), targetZip, format.Options{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	extractDir := filepath.Join(dir, "lib")
+	opts := format.Options{Globs: []string{"**/*.jar"}, Flatten: true}
+	if err := Unzip(context.Background(), targetZip, extractDir, opts); err == nil {
+		t.Fatalf("expected the core.jar collision to fail")
+	}
+
+	os.RemoveAll(extractDir)
+	opts.FlattenCollision = format.CollisionRename
+	if err := Unzip(context.Background(), targetZip, extractDir, opts); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	entries, _ := os.ReadDir(extractDir)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	expected := []string{"core-1.jar", "core.jar"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestUnzipLimits(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "limits.zip")
+	file, _ := os.Create(source)
+	writer := zip.NewWriter(file)
+	for _, name := range []string{"a.txt", "b.txt", "sub/c.txt"} {
+		w, _ := writer.Create(name)
+		w.Write([]byte(strings.Repeat("x", 600)))
+	}
+	writer.Close()
+	file.Close()
+
+	tests := []struct {
+		name   string
+		limits format.Limits
+	}{
+		{"total size", format.Limits{MaxTotalSize: 1000}},
+		{"file size", format.Limits{MaxFileSize: 100}},
+		{"entries", format.Limits{MaxEntries: 2}},
+		{"depth", format.Limits{MaxDepth: 1}},
+		{"ratio", format.Limits{MaxRatio: 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Extract into an existing directory, whose files must survive
+			target := t.TempDir()
+			os.WriteFile(filepath.Join(target, "keep.txt"), []byte("keep"), 0644)
+
+			var limited *format.LimitError
+			err := Unzip(context.Background(), source, target, format.Options{Limits: test.limits})
+			if !errors.As(err, &limited) {
+				t.Fatalf("expected LimitError, got %v", err)
+			}
+
+			entries, _ := os.ReadDir(target)
+			if len(entries) != 1 || entries[0].Name() != "keep.txt" {
+				t.Errorf("expected only keep.txt to be left, got %v", entries)
+			}
+		})
+	}
+}
+
+func TestZipFlatten(t *testing.T) {
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "dist")
+	os.MkdirAll(filepath.Join(sourceDir, "a"), 0755)
+	os.MkdirAll(filepath.Join(sourceDir, "b"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "a", "x.jar"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "b", "x.jar"), []byte("b"), 0644)
+
+	tests := []struct {
+		collision string
+		expected  []string
+		fail      bool
+	}{
+		{format.CollisionFail, nil, true},
+		{format.CollisionRename, []string{"lib/x.jar", "lib/x-1.jar"}, false},
+		{format.CollisionOverwrite, nil, true},
+	}
+
+	for _, test := range tests {
+		targetZip := filepath.Join(dir, test.collision+".zip")
+		opts := format.Options{Flatten: true, FlattenCollision: test.collision, Prefix: "lib"}
+		err := Zip(context.Background(), format.Sources(sourceDir), targetZip, opts)
+		if test.fail {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.collision)
+			}
+			if _, err := os.Stat(targetZip); !os.IsNotExist(err) {
+				t.Errorf("%s: expected no archive, got %v", test.collision, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", test.collision, err)
+		}
+
+		reader, err := zip.OpenReader(targetZip)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		var names []string
+		for _, file := range reader.File {
+			names = append(names, file.Name)
+		}
+		reader.Close()
+		if strings.Join(names, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("%s: expected %v, got %v", test.collision, test.expected, names)
+		}
+	}
+}
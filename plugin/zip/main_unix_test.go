@@ -0,0 +1,57 @@
+// Copyright 2024 the Drone Authors. All rights reserved.
+// Use of this source code is governed by the Blue Oak Model License
+// that can be found in the LICENSE file.
+
+//go:build !windows
+
+package zip
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/harness-community/drone-archive/plugin/format"
+	"github.com/harness-community/drone-archive/plugin/internal/testutil"
+)
+
+// TestUnzipManyFiles extracts more entries than the process may hold open
+// descriptors, which fails if extracted files are only closed at the end.
+func TestUnzipManyFiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping extraction of 20000 files in short mode")
+	}
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "many.zip")
+	file, err := os.Create(source)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	archive := zip.NewWriter(file)
+	for i := 0; i < 20000; i++ {
+		w, err := archive.Create(fmt.Sprintf("files/%d.txt", i))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		fmt.Fprintf(w, "file %d", i)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	file.Close()
+
+	testutil.LowerFileLimit(t, 256)
+
+	target := filepath.Join(dir, "out")
+	if err := Unzip(context.Background(), source, target, format.Options{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(target, "files", "19999.txt"))
+	if err != nil || string(content) != "file 19999" {
+		t.Errorf("expected last file to be extracted, got %q, %v", content, err)
+	}
+}